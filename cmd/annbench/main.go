@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"ragbook/internal/embeddings"
+	"ragbook/internal/flagutil"
+	"ragbook/internal/rag"
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+// annbench compares HNSWStore against the exact MemoryStore on the same
+// embeddings, reporting recall@k and query latency for each ef_search value.
+func main() {
+	// ---- Flags ----
+	books := flag.String("books", "data/book.txt", "Comma-separated book text files to index")
+	evalFile := flag.String("eval", "testdata/eval_cases.json", "Evaluation cases whose queries are included in the query set")
+	chunkSize := flag.Int("chunk_size", 800, "Chunk size in characters for ingestion")
+	chunkOverlap := flag.Int("chunk_overlap", 200, "Overlap between chunks in characters")
+	dim := flag.Int("dim", 512, "Embedding dimension")
+	topK := flag.Int("top_k", 10, "Neighbors per query used to compute recall")
+	samples := flag.Int("samples", 200, "Number of chunk-derived queries to add to the query set")
+	m := flag.Int("m", 16, "HNSW links per node")
+	efConstruction := flag.Int("ef_construction", 200, "HNSW candidate list size during inserts")
+	efSearch := flag.String("ef_search", "16,32,64,128", "Comma-separated HNSW ef_search values to benchmark")
+	seed := flag.Int64("seed", 1, "Seed for query sampling and HNSW level assignment")
+	flag.Parse()
+
+	efs, err := flagutil.PositiveInts(*efSearch)
+	if err != nil {
+		log.Fatalf("ef_search: %v", err)
+	}
+
+	// ---- Ingest once into the exact store ----
+	embedder := embeddings.NewHashEmbedder(*dim)
+	exact := store.NewMemoryStore()
+	pipeline := rag.NewPipeline(exact, embedder)
+
+	ctx := context.Background()
+	for i, path := range strings.Split(*books, ",") {
+		text, err := os.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			log.Fatalf("read book: %v", err)
+		}
+		_, err = pipeline.IngestBook(ctx, fmt.Sprintf("book-%d", i), string(text), rag.IngestConfig{
+			ChunkSize:        *chunkSize,
+			ChunkOverlap:     *chunkOverlap,
+			NormalizeSpaces:  true,
+			StripBoilerplate: true,
+		})
+		if err != nil {
+			log.Fatalf("ingest: %v", err)
+		}
+	}
+
+	// ---- Copy the same chunks into the HNSW index ----
+	chunks := exact.Chunks()
+	ann := store.NewHNSWStore(store.HNSWConfig{M: *m, EfConstruction: *efConstruction, Seed: *seed})
+	start := time.Now()
+	for _, c := range chunks {
+		if err := ann.AddChunk(c); err != nil {
+			log.Fatalf("hnsw insert: %v", err)
+		}
+	}
+	buildTime := time.Since(start)
+
+	queries, err := buildQueries(*evalFile, chunks, *samples, *seed)
+	if err != nil {
+		log.Fatalf("queries: %v", err)
+	}
+	qembs, err := embedder.Embed(queries)
+	if err != nil {
+		log.Fatalf("embed queries: %v", err)
+	}
+
+	// ---- Ground truth ----
+	truth := make([]map[string]bool, len(qembs))
+	start = time.Now()
+	for i, q := range qembs {
+		res, err := exact.Search(q, store.SearchOptions{TopK: *topK})
+		if err != nil {
+			log.Fatalf("exact search: %v", err)
+		}
+		truth[i] = make(map[string]bool, len(res))
+		for _, r := range res {
+			truth[i][r.ID] = true
+		}
+	}
+	exactLatency := time.Since(start) / time.Duration(len(qembs))
+
+	fmt.Printf("\n=== ANN benchmark (chunks=%d, queries=%d, top_k=%d, M=%d, ef_construction=%d) ===\n",
+		len(chunks), len(qembs), *topK, *m, *efConstruction)
+	fmt.Printf("HNSW build time: %v\n", buildTime)
+	fmt.Printf("Exact search:    %v/query\n\n", exactLatency)
+	fmt.Printf("%-10s %-10s %-14s %s\n", "ef_search", "recall@k", "latency", "speedup")
+
+	for _, ef := range efs {
+		ann.SetEfSearch(ef)
+		hits, total := 0, 0
+		start := time.Now()
+		for i, q := range qembs {
+			res, err := ann.Search(q, store.SearchOptions{TopK: *topK})
+			if err != nil {
+				log.Fatalf("hnsw search: %v", err)
+			}
+			for _, r := range res {
+				if truth[i][r.ID] {
+					hits++
+				}
+			}
+			total += len(truth[i])
+		}
+		latency := time.Since(start) / time.Duration(len(qembs))
+		recall := 0.0
+		if total > 0 {
+			recall = float64(hits) / float64(total)
+		}
+		fmt.Printf("%-10d %-10.3f %-14v %.1fx\n", ef, recall, latency, float64(exactLatency)/float64(max(latency, 1)))
+	}
+}
+
+// buildQueries returns the eval-case queries plus the opening words of
+// randomly sampled chunks.
+func buildQueries(evalFile string, chunks []types.DocumentChunk, samples int, seed int64) ([]string, error) {
+	var queries []string
+	if data, err := os.ReadFile(evalFile); err == nil {
+		var cases []struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal(data, &cases); err != nil {
+			return nil, fmt.Errorf("parse eval cases: %w", err)
+		}
+		for _, c := range cases {
+			queries = append(queries, c.Query)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < samples && len(chunks) > 0; i++ {
+		words := strings.Fields(chunks[rng.Intn(len(chunks))].Text)
+		queries = append(queries, strings.Join(words[:min(len(words), 12)], " "))
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries")
+	}
+	return queries, nil
+}
@@ -4,10 +4,15 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"ragbook/internal/analysis"
 	"ragbook/internal/embeddings"
 	"ragbook/internal/eval"
 	"ragbook/internal/rag"
@@ -22,13 +27,88 @@ func main() {
 	topK := flag.Int("top_k", 3, "Number of chunks to retrieve per query")
 	chunkSize := flag.Int("chunk_size", 800, "Chunk size in characters for ingestion")
 	chunkOverlap := flag.Int("chunk_overlap", 200, "Overlap between chunks in characters")
-	cosineThreshold := flag.Float64("cosine_threshold", 0.0, "Minimum similarity score for retrieved chunks (0–1)")
+	cosineThreshold := flag.Float64("cosine_threshold", 0.0, "Minimum similarity score for retrieved chunks (0–1); no threshold unless set")
+	metric := flag.String("metric", "cosine", "Similarity metric: cosine, dot or l2")
+	chunker := flag.String("chunker", "fixed", "Chunking strategy: fixed or structured")
+	strip := flag.Bool("strip_boilerplate", true, "Remove Project Gutenberg header/footer, transcriber notes and contents before chunking")
+	mode := flag.String("retrieval_mode", "vector", "Retrieval mode: vector, keyword, hybrid or hybrid_weighted")
+	diversity := flag.String("diversity", "none", "Result diversification: none, mmr or dedupe")
+	mmrLambda := flag.Float64("mmr_lambda", rag.DefaultMMRLambda, "Relevance weight for --diversity=mmr, 0-1")
+	expand := flag.Int("expand", 0, "Neighbor chunks stitched onto each side of a retrieved chunk (0-5)")
+	rerank := flag.String("rerank", "none", "Reranker: none, proximity, bm25 or cross_encoder")
+	rerankDepth := flag.Int("rerank_depth", 0, "Candidates retrieved for reranking (0 means 50)")
+	rerankURL := flag.String("rerank_url", "", "Base URL of a /rerank endpoint for --rerank=cross_encoder")
+	rerankModel := flag.String("rerank_model", "", "Model for --rerank=cross_encoder")
+	match := flag.String("match", "substring", "Keyword matching: substring, word or stem")
+	embedderName := flag.String("embedder", "hash", "Embedder: hash, tfidf, openai or ollama")
+	embeddingModel := flag.String("embedding_model", "", "Model for --embedder=openai or ollama (default text-embedding-3-small or nomic-embed-text)")
+	embeddingURL := flag.String("embedding_url", "", "Base URL for --embedder=openai or ollama")
+	analyzerSpec := flag.String("analyzer", "plain", "Text analysis for embeddings and BM25, e.g. stem+stop+bigrams+char3")
+	hashSigned := flag.Bool("hash_signed", false, "Give each hashed term a ±1 sign so collisions cancel out")
+	hashK := flag.Int("hash_k", 1, "Number of hash functions (buckets) per term")
+	bigramWeight := flag.Float64("bigram_weight", 1, "Weight of bigram terms relative to words")
+	charWeight := flag.Float64("char_weight", 1, "Weight of character n-gram terms relative to words")
+	concurrency := flag.Int("concurrency", 4, "Number of queries evaluated in parallel")
+	reportJSON := flag.String("report_json", "", "Write a JSON report to this file")
+	reportCSV := flag.String("report_csv", "", "Write a CSV report to this file")
+	reportMD := flag.String("report_md", "", "Write a Markdown report to this file")
+	baseline := flag.String("baseline", "", "JSON report of a previous run to compare against")
+	failOn := flag.String("fail_on", eval.MetricKeywordF1, "Comma-separated metrics whose average may not get worse than in the baseline")
+	tolerance := flag.Float64("tolerance", 0.01, "Allowed worsening of a checked average before --baseline fails")
 	flag.Parse()
 
 	// ---- Components ----
-	embedder := embeddings.NewHashEmbedder(512)
-	vectorStore := store.NewMemoryStore()
-	pipeline := rag.NewPipeline(vectorStore, embedder)
+	m, err := store.ParseMetric(*metric)
+	if err != nil {
+		log.Fatalf("metric: %v", err)
+	}
+	strategy, err := rag.ParseChunkStrategy(*chunker)
+	if err != nil {
+		log.Fatalf("chunker: %v", err)
+	}
+	matcher, err := eval.ParseMatcher(*match)
+	if err != nil {
+		log.Fatalf("match: %v", err)
+	}
+	analyzer, err := analysis.ParseAnalyzer(*analyzerSpec)
+	if err != nil {
+		log.Fatalf("analyzer: %v", err)
+	}
+	var embedder embeddings.Embedder
+	switch *embedderName {
+	case "openai", "ollama":
+		embedder, err = embeddings.NewRemote(*embedderName, embeddings.RemoteConfig{
+			BaseURL: *embeddingURL,
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Model:   remoteModel(*embedderName, *embeddingModel),
+		})
+	default:
+		embedder, err = embeddings.New(*embedderName, embeddings.HashOptions{
+			Dim:      512,
+			Analyzer: analyzer,
+			Hashing:  embeddings.FeatureHashing{Signed: *hashSigned, Hashes: *hashK},
+			Weights:  embeddings.FeatureWeights{Bigram: float32(*bigramWeight), CharNGram: float32(*charWeight)},
+		})
+	}
+	if err != nil {
+		log.Fatalf("embedder: %v", err)
+	}
+	vectorStore, err := store.NewMemoryStoreWithMetric(m)
+	if err != nil {
+		log.Fatalf("store: %v", err)
+	}
+	opts := []rag.Option{rag.WithKeywordAnalyzer(analyzer)}
+	if *rerank == string(rag.RerankCrossEncoder) && *rerankURL == "" {
+		log.Fatalf("rerank: --rerank=%s requires --rerank_url", *rerank)
+	}
+	if *rerankURL != "" {
+		opts = append(opts, rag.WithReranker(&rag.HTTPReranker{
+			BaseURL: *rerankURL,
+			APIKey:  os.Getenv("RERANK_API_KEY"),
+			Model:   *rerankModel,
+		}))
+	}
+	pipeline := rag.NewPipeline(vectorStore, embedder, opts...)
 
 	text, err := os.ReadFile(*bookPath)
 	if err != nil {
@@ -38,31 +118,180 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
+	start := time.Now()
 	_, err = pipeline.IngestBook(ctx, *bookID, string(text), rag.IngestConfig{
-		ChunkSize:       *chunkSize,
-		ChunkOverlap:    *chunkOverlap,
-		NormalizeSpaces: true,
+		ChunkSize:        *chunkSize,
+		ChunkOverlap:     *chunkOverlap,
+		NormalizeSpaces:  true,
+		Chunker:          strategy,
+		StripBoilerplate: *strip,
 	})
 	if err != nil {
 		log.Fatalf("ingest: %v", err)
 	}
+	ingestTime := time.Since(start)
 
-	// --- Run evaluation with threshold ---
-	result, err := eval.EvaluateWithThreshold(ctx, pipeline, *evalFile, *topK, float32(*cosineThreshold))
+	// --- Run evaluation ---
+	// Only a threshold given on the command line is applied: a default of
+	// 0 would drop every negative-L2 score.
+	var threshold *float32
+	thresholdLabel := "none"
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "cosine_threshold" {
+			t := float32(*cosineThreshold)
+			threshold = &t
+			thresholdLabel = strconv.FormatFloat(*cosineThreshold, 'f', -1, 64)
+		}
+	})
+	lambda := float32(*mmrLambda)
+	runner, err := eval.NewRunner(pipeline, eval.Options{
+		TopK:          *topK,
+		Threshold:     threshold,
+		RetrievalMode: *mode,
+		Diversity:     *diversity,
+		MMRLambda:     &lambda,
+		Expand:        *expand,
+		Rerank:        *rerank,
+		RerankDepth:   *rerankDepth,
+		Matcher:       matcher,
+		Concurrency:   *concurrency,
+	})
+	if err != nil {
+		log.Fatalf("evaluation: %v", err)
+	}
+	start = time.Now()
+	result, err := runner.RunFile(ctx, *evalFile)
 	if err != nil {
 		log.Fatalf("evaluation failed: %v", err)
 	}
+	evalTime := time.Since(start)
 
 	// --- Print results ---
 	fmt.Printf(
-		"\n=== Evaluation Results (top_k=%d, chunk_size=%d, overlap=%d, threshold=%.2f) ===\n",
-		*topK, *chunkSize, *chunkOverlap, *cosineThreshold,
+		"\n=== Evaluation Results (top_k=%d, chunk_size=%d, overlap=%d, threshold=%s, metric=%s, chunker=%s, mode=%s, embedder=%s) ===\n",
+		*topK, *chunkSize, *chunkOverlap, thresholdLabel, m, strategy, *mode, embedder.Name(),
 	)
 	for _, c := range result.CaseResults {
-		fmt.Printf("Q: %-45s  P: %.2f  R: %.2f  F1: %.2f\n", c.Query, c.Precision, c.Recall, c.F1Score)
+		fmt.Printf("Q: %-45s  P: %.2f  R: %.2f  F1: %.2f\n", c.Query,
+			c.Scores[eval.MetricKeywordPrecision], c.Scores[eval.MetricKeywordRecall], c.Scores[eval.MetricKeywordF1])
 		fmt.Printf("   Matched keywords: %v\n", c.MatchedWords)
+		if _, ok := c.Scores[eval.MetricMRR]; ok {
+			fmt.Printf("   Recall@%d: %.2f  Precision@%d: %.2f  MRR: %.2f  nDCG@%d: %.2f  Hit: %.0f\n",
+				*topK, c.Scores[eval.MetricRecallAtK], *topK, c.Scores[eval.MetricPrecisionAtK],
+				c.Scores[eval.MetricMRR], *topK, c.Scores[eval.MetricNDCG], c.Scores[eval.MetricHitRate])
+		}
+	}
+
+	fmt.Printf("\n%-20s %-8s %s\n", "Metric", "Average", "Cases")
+	for _, name := range result.Metrics {
+		fmt.Printf("%-20s %-8.3f %d\n", name, result.Average(name), result.Counts[name])
+	}
+
+	// --- Reports ---
+	report := eval.NewReport(result, map[string]string{
+		"book":              *bookPath,
+		"eval":              *evalFile,
+		"top_k":             strconv.Itoa(*topK),
+		"chunk_size":        strconv.Itoa(*chunkSize),
+		"chunk_overlap":     strconv.Itoa(*chunkOverlap),
+		"cosine_threshold":  thresholdLabel,
+		"metric":            string(m),
+		"chunker":           string(strategy),
+		"strip_boilerplate": strconv.FormatBool(*strip),
+		"retrieval_mode":    *mode,
+		"diversity":         *diversity,
+		"mmr_lambda":        strconv.FormatFloat(*mmrLambda, 'f', -1, 64),
+		"expand":            strconv.Itoa(*expand),
+		"rerank":            *rerank,
+		"rerank_depth":      strconv.Itoa(*rerankDepth),
+		"match":             *match,
+		"embedder":          embedder.Name(),
+	}, ingestTime, evalTime)
+	for path, write := range map[string]func(io.Writer) error{
+		*reportJSON: report.WriteJSON,
+		*reportCSV:  report.WriteCSV,
+		*reportMD:   report.WriteMarkdown,
+	} {
+		if path == "" {
+			continue
+		}
+		if err := writeFile(path, write); err != nil {
+			log.Fatalf("report: %v", err)
+		}
+	}
+
+	// --- Baseline comparison ---
+	if *baseline == "" {
+		return
+	}
+	base, err := eval.LoadReport(*baseline)
+	if err != nil {
+		log.Fatalf("baseline: %v", err)
+	}
+	checked := splitList(*failOn)
+	for _, name := range checked {
+		if !slices.Contains(report.Metrics, name) {
+			log.Fatalf("fail_on: unknown metric %q", name)
+		}
+	}
+	cmp := eval.Compare(base, report, checked, *tolerance)
+	fmt.Printf("\n=== Compared with %s ===\n", *baseline)
+	for _, c := range cmp.Cases {
+		var changed []string
+		for _, d := range c.Deltas {
+			if d.Delta != 0 {
+				changed = append(changed, fmt.Sprintf("%s %+.3f", d.Metric, d.Delta))
+			}
+		}
+		if len(changed) > 0 {
+			fmt.Printf("Q: %-45s  %s\n", c.Query, strings.Join(changed, ", "))
+		}
+	}
+	fmt.Printf("\n%-20s %-9s %-9s %s\n", "Metric", "Baseline", "Current", "Delta")
+	for _, d := range cmp.Averages {
+		fmt.Printf("%-20s %-9.3f %-9.3f %+.3f\n", d.Metric, d.Baseline, d.Current, d.Delta)
+	}
+	for _, d := range cmp.Regressions {
+		fmt.Printf("REGRESSION: %s worsened by %.3f (tolerance %.3f)\n", d.Metric, d.Worsening(), *tolerance)
+	}
+	for _, m := range cmp.Missing {
+		fmt.Printf("MISSING: %s has no average in the baseline or this run\n", m)
+	}
+	if cmp.Failed() {
+		os.Exit(1)
+	}
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// remoteModel returns model, or the default embedding model of provider.
+func remoteModel(provider, model string) string {
+	switch {
+	case model != "":
+		return model
+	case provider == "openai":
+		return "text-embedding-3-small"
+	default:
+		return "nomic-embed-text"
 	}
-	fmt.Printf("\nAverage Precision: %.2f\n", result.AverageP)
-	fmt.Printf("Average Recall:    %.2f\n", result.AverageR)
-	fmt.Printf("Average F1:        %.2f\n", result.AverageF1)
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"ragbook/internal/analysis"
+	"ragbook/internal/embeddings"
+	"ragbook/internal/flagutil"
+	"ragbook/internal/rag"
+)
+
+// hashdiag reports how often the terms of a corpus collide when hashed into
+// embedding vectors, for each dimension and number of hash functions, so the
+// dimension can be chosen from data rather than guessed.
+func main() {
+	// ---- Flags ----
+	books := flag.String("books", "data/book.txt", "Comma-separated book text files to analyze")
+	analyzerSpec := flag.String("analyzer", "plain", "Text analysis used by the embedder, e.g. stem+stop+bigrams+char3")
+	dims := flag.String("dims", "128,256,512,1024,2048,4096", "Comma-separated embedding dimensions to check")
+	hashes := flag.String("hashes", "1,2,3", "Comma-separated numbers of hash functions per term to check")
+	target := flag.Float64("target", 0.05, "Weighted collision rate to recommend the smallest dimension for")
+	strip := flag.Bool("strip_boilerplate", true, "Remove Project Gutenberg header/footer before counting terms")
+	flag.Parse()
+
+	analyzer, err := analysis.ParseAnalyzer(*analyzerSpec)
+	if err != nil {
+		log.Fatalf("analyzer: %v", err)
+	}
+	ds, err := flagutil.PositiveInts(*dims)
+	if err != nil {
+		log.Fatalf("dims: %v", err)
+	}
+	ks, err := flagutil.PositiveInts(*hashes)
+	if err != nil {
+		log.Fatalf("hashes: %v", err)
+	}
+
+	// ---- Count terms ----
+	counts := make(map[string]int)
+	for _, path := range strings.Split(*books, ",") {
+		data, err := os.ReadFile(strings.TrimSpace(path))
+		if err != nil {
+			log.Fatalf("read book: %v", err)
+		}
+		text := string(data)
+		if *strip {
+			text, _ = rag.StripBoilerplate(text)
+		}
+		for _, t := range analyzer.Analyze(text) {
+			counts[t]++
+		}
+	}
+
+	// ---- Report ----
+	fmt.Printf("\n=== Hash collisions (analyzer=%s, distinct terms=%d) ===\n", analyzer.Name(), len(counts))
+	fmt.Printf("%-8s %-8s %-10s %-10s %-12s %s\n", "dim", "hashes", "occupied", "colliding", "term rate", "weighted rate")
+	best := make(map[int]int)
+	for _, k := range ks {
+		for _, d := range ds {
+			r := embeddings.FeatureHashing{Hashes: k}.Collisions(counts, d)
+			fmt.Printf("%-8d %-8d %-10d %-10d %-12.3f %.3f\n", d, k, r.OccupiedBuckets, r.CollidingTerms, r.Rate, r.WeightedRate)
+			if _, ok := best[k]; !ok && r.WeightedRate <= *target {
+				best[k] = d
+			}
+		}
+	}
+
+	fmt.Println()
+	for _, k := range ks {
+		if d, ok := best[k]; ok {
+			fmt.Printf("hashes=%d: dim %d keeps the weighted collision rate at or below %.2f\n", k, d, *target)
+		} else {
+			fmt.Printf("hashes=%d: no dimension checked reaches %.2f\n", k, *target)
+		}
+	}
+}
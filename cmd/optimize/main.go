@@ -2,75 +2,171 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"ragbook/internal/embeddings"
 	"ragbook/internal/eval"
+	"ragbook/internal/optimize"
 	"ragbook/internal/rag"
 	"ragbook/internal/store"
 )
 
 func main() {
-	paramGrid := []struct {
-		topK            int
-		chunkSize       int
-		chunkOverlap    int
-		cosineThreshold float32
+	// ---- Flags ----
+	configPath := flag.String("config", "testdata/optimize.json", "Search space and strategy config (JSON)")
+	bookPath := flag.String("book", "", "Path to book text file (overrides config)")
+	evalPath := flag.String("eval", "", "Path to evaluation cases JSON (overrides config)")
+	strategyName := flag.String("strategy", "", "Search strategy: grid, random or halving (overrides config)")
+	objective := flag.String("objective", "", "Eval metric to maximize, e.g. keyword_f1 or mrr; not redundancy (overrides config)")
+	samples := flag.Int("samples", 0, "Candidates tried by random and halving (overrides config)")
+	leaderboard := flag.String("leaderboard", "", "Leaderboard output file; .csv for CSV, JSON otherwise (overrides config)")
+	workers := flag.Int("workers", 0, "Trials evaluated in parallel (overrides config)")
+	flag.Parse()
+
+	cfg, err := optimize.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	for _, o := range []struct {
+		dst *string
+		val string
 	}{
-		{2, 600, 100, 0.0},
-		{3, 800, 200, 0.2},
-		{5, 1000, 300, 0.2},
-		{3, 800, 200, 0.4},
-		{2, 600, 200, 0.3},
+		{&cfg.Book, *bookPath},
+		{&cfg.Eval, *evalPath},
+		{&cfg.Strategy, *strategyName},
+		{&cfg.Objective, *objective},
+		{&cfg.Leaderboard, *leaderboard},
+	} {
+		if o.val != "" {
+			*o.dst = o.val
+		}
+	}
+	if *samples > 0 {
+		cfg.Samples = *samples
+	}
+	if *workers > 0 {
+		cfg.Workers = *workers
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("config: %v", err)
 	}
 
-	bookPath := "data/book.txt"
-	evalPath := "testdata/eval_cases.json"
-
-	text, err := os.ReadFile(bookPath)
+	strategy, err := optimize.ParseStrategy(cfg.Strategy, cfg.Samples, cfg.Eta, cfg.Seed)
+	if err != nil {
+		log.Fatalf("strategy: %v", err)
+	}
+	text, err := os.ReadFile(cfg.Book)
 	if err != nil {
 		log.Fatalf("read book: %v", err)
 	}
+	all, err := eval.LoadCases(cfg.Eval)
+	if err != nil {
+		log.Fatalf("eval cases: %v", err)
+	}
+	cases, err := optimize.ObjectiveCases(cfg.Objective, all)
+	if err != nil {
+		log.Fatalf("eval cases: %v", err)
+	}
+	if len(cases) < len(all) {
+		log.Printf("Scoring %s on the %d of %d eval cases with relevant passages", cfg.Objective, len(cases), len(all))
+	}
+	candidates := cfg.Space.Grid()
+	for _, p := range candidates {
+		if _, err := rag.ParseRetrievalMode(p.RetrievalMode); err != nil {
+			log.Fatalf("space: %v", err)
+		}
+	}
 
-	bestF1 := 0.0
-	var bestParams interface{}
-
-	for _, p := range paramGrid {
-		fmt.Printf("\n=== Testing top_k=%d, chunk=%d, overlap=%d, threshold=%.2f ===\n",
-			p.topK, p.chunkSize, p.chunkOverlap, p.cosineThreshold)
+	// ---- Search ----
+	// Trials that differ only in top_k, threshold or retrieval mode share
+	// one ingested index.
+	indexes := optimize.NewIndexCache(cfg.MaxIndexes, func(ctx context.Context, key optimize.IngestKey) (*rag.Pipeline, error) {
+		return ingest(ctx, string(text), key)
+	})
+	study := &optimize.Study{
+		Cases:     cases,
+		Objective: cfg.Objective,
+		Workers:   cfg.Workers,
+		Evaluate: func(ctx context.Context, p optimize.Params, cases []eval.TestCase) (*eval.Result, error) {
+			return evaluate(ctx, indexes, p, cases)
+		},
+		Progress: func(t optimize.Trial) {
+			fmt.Printf("%-70s cases=%-3d %s=%.3f\n", t.Params, t.Cases, cfg.Objective, t.Score)
+		},
+	}
+	fmt.Printf("=== %s search over %d candidates, objective %s, %d workers ===\n",
+		cfg.Strategy, len(candidates), cfg.Objective, max(cfg.Workers, 1))
+	start := time.Now()
+	trials, err := strategy.Run(context.Background(), study, candidates)
+	if err != nil {
+		log.Fatalf("optimize: %v", err)
+	}
+	fmt.Printf("\n%d trials in %v, %d indexes built\n", len(trials), time.Since(start).Round(time.Millisecond), indexes.Builds())
+	if len(trials) == 0 {
+		log.Fatalf("optimize: no trials ran")
+	}
+	ranked := optimize.Leaderboard(trials)
 
-		embedder := embeddings.NewHashEmbedder(512)
-		store := store.NewMemoryStore()
-		pipeline := rag.NewPipeline(store, embedder)
+	// ---- Leaderboard ----
+	f, err := os.Create(cfg.Leaderboard)
+	if err != nil {
+		log.Fatalf("leaderboard: %v", err)
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(cfg.Leaderboard)), ".")
+	if err := optimize.WriteLeaderboard(f, format, cfg.Objective, ranked); err != nil {
+		log.Fatalf("leaderboard: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("leaderboard: %v", err)
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-		defer cancel()
+	fmt.Printf("\nTop results (%s):\n", cfg.Leaderboard)
+	for i, t := range ranked[:min(len(ranked), 5)] {
+		fmt.Printf("%d. %s=%.3f  %s\n", i+1, cfg.Objective, t.Score, t.Params)
+	}
+}
 
-		_, err := pipeline.IngestBook(ctx, "alice", string(text), rag.IngestConfig{
-			ChunkSize:       p.chunkSize,
-			ChunkOverlap:    p.chunkOverlap,
-			NormalizeSpaces: true,
-		})
-		if err != nil {
-			log.Fatalf("ingest: %v", err)
-		}
+// ingest builds a pipeline holding the book chunked and embedded per key.
+func ingest(ctx context.Context, text string, key optimize.IngestKey) (*rag.Pipeline, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
 
-		result, err := eval.EvaluateWithThreshold(ctx, pipeline, evalPath, p.topK, p.cosineThreshold)
-		if err != nil {
-			log.Fatalf("eval: %v", err)
-		}
+	pipeline := rag.NewPipeline(store.NewMemoryStore(), embeddings.NewHashEmbedder(key.Dim))
+	_, err := pipeline.IngestBook(ctx, "alice", text, rag.IngestConfig{
+		ChunkSize:        key.ChunkSize,
+		ChunkOverlap:     key.ChunkOverlap,
+		NormalizeSpaces:  true,
+		StripBoilerplate: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ingest: %w", err)
+	}
+	return pipeline, nil
+}
 
-		fmt.Printf("F1: %.3f (Precision %.3f, Recall %.3f)\n",
-			result.AverageF1, result.AverageP, result.AverageR)
+// evaluate runs the cases against the cached index for p's ingestion
+// parameters with p's retrieval settings.
+func evaluate(ctx context.Context, indexes *optimize.IndexCache, p optimize.Params, cases []eval.TestCase) (*eval.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
 
-		if result.AverageF1 > bestF1 {
-			bestF1 = result.AverageF1
-			bestParams = p
-		}
+	pipeline, err := indexes.Get(ctx, p.IngestKey())
+	if err != nil {
+		return nil, err
 	}
-
-	fmt.Printf("\n Best F1=%.3f with params: %+v\n", bestF1, bestParams)
+	runner, err := eval.NewRunner(pipeline, eval.Options{
+		TopK:          p.TopK,
+		Threshold:     &p.Threshold,
+		RetrievalMode: p.RetrievalMode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return runner.Run(ctx, cases)
 }
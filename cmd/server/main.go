@@ -2,15 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"time"
 
+	"ragbook/internal/analysis"
 	"ragbook/internal/api"
 	"ragbook/internal/embeddings"
 	"ragbook/internal/rag"
 	"ragbook/internal/store"
+	"ragbook/internal/types"
 )
 
 func mustReadBook(path string) string {
@@ -31,28 +37,52 @@ func main() {
 		bookID = "detective-fiction"
 	}
 
-	log.Printf("Loading book from: %s (bookID=%s)", bookPath, bookID)
-
-	bookText := mustReadBook(bookPath)
+	metric, err := store.ParseMetric(os.Getenv("SIMILARITY_METRIC"))
+	if err != nil {
+		log.Fatalf("invalid SIMILARITY_METRIC: %v", err)
+	}
+	chunker, err := rag.ParseChunkStrategy(os.Getenv("CHUNKER"))
+	if err != nil {
+		log.Fatalf("invalid CHUNKER: %v", err)
+	}
 
-	embedder := embeddings.NewHashEmbedder(512)
-	vectorStore := store.NewMemoryStore()
-	pipeline := rag.NewPipeline(vectorStore, embedder)
+	analyzer, err := analysis.ParseAnalyzer(os.Getenv("ANALYZER"))
+	if err != nil {
+		log.Fatalf("invalid ANALYZER: %v", err)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
+	hashing, err := parseHashing(os.Getenv("HASH_SIGNED"), os.Getenv("HASH_FUNCTIONS"))
+	if err != nil {
+		log.Fatalf("invalid hashing options: %v", err)
+	}
 
-	log.Printf("Ingesting book into vector store...")
-	nChunks, err := pipeline.IngestBook(ctx, bookID, bookText, rag.IngestConfig{
-		ChunkSize:       800,
-		ChunkOverlap:    200,
-		MaxChunks:       0,
-		NormalizeSpaces: true,
+	embedder := newEmbedder(os.Getenv("EMBEDDER"), os.Getenv("INDEX_DIR"), embeddings.HashOptions{
+		Dim:      512,
+		Analyzer: analyzer,
+		Hashing:  hashing,
 	})
-	if err != nil {
-		log.Fatalf("failed to ingest book: %v", err)
+	vectorStore := openStore(os.Getenv("INDEX_DIR"), metric, embedder)
+	defaults := queryDefaults()
+	opts := []rag.Option{
+		rag.WithGenerator(newGenerator()),
+		rag.WithKeywordAnalyzer(analyzer),
+		rag.WithQueryDefaults(defaults),
+	}
+	if reranker := newReranker(); reranker != nil {
+		opts = append(opts, rag.WithReranker(reranker))
+	} else if defaults.Rerank == string(rag.RerankCrossEncoder) {
+		log.Fatalf("QUERY_RERANK=%s requires RERANK_URL", defaults.Rerank)
+	}
+	pipeline := rag.NewPipeline(vectorStore, embedder, opts...)
+
+	if n := vectorStore.Count(); n > 0 {
+		log.Printf("Loaded %d chunks from existing index", n)
+	}
+	if hasBook(pipeline, bookID) {
+		log.Printf("Book %s already indexed, skipping ingestion", bookID)
+	} else {
+		ingestBook(pipeline, bookPath, bookID, chunker)
 	}
-	log.Printf("Ingested %d chunks", nChunks)
 
 	router := api.NewRouter(pipeline)
 	addr := ":8080"
@@ -61,3 +91,267 @@ func main() {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+// newGenerator builds the answer generator from LLM_* environment variables.
+// Without LLM_PROVIDER answers are extractive; with it, model errors fall back
+// to extractive answers.
+func newGenerator() rag.Generator {
+	var llm rag.Generator
+	switch provider := os.Getenv("LLM_PROVIDER"); provider {
+	case "":
+		return rag.ExtractiveGenerator{}
+	case "openai":
+		apiKey := os.Getenv("LLM_API_KEY")
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+		llm = &rag.OpenAIGenerator{
+			BaseURL:     os.Getenv("LLM_BASE_URL"),
+			APIKey:      apiKey,
+			Model:       envOr("LLM_MODEL", "gpt-4o-mini"),
+			Temperature: envFloat("LLM_TEMPERATURE"),
+		}
+	case "ollama":
+		llm = &rag.OllamaGenerator{
+			BaseURL:     os.Getenv("LLM_BASE_URL"),
+			Model:       envOr("LLM_MODEL", "llama3.1"),
+			Temperature: envFloat("LLM_TEMPERATURE"),
+		}
+	default:
+		log.Fatalf("invalid LLM_PROVIDER %q (want openai or ollama)", provider)
+	}
+	log.Printf("Generating answers with %s", os.Getenv("LLM_PROVIDER"))
+	return rag.FallbackGenerator{Primary: llm, Fallback: rag.ExtractiveGenerator{}}
+}
+
+// newReranker builds the cross-encoder reranker from RERANK_* environment
+// variables, or returns nil without RERANK_URL.
+func newReranker() rag.Reranker {
+	baseURL := os.Getenv("RERANK_URL")
+	if baseURL == "" {
+		return nil
+	}
+	log.Printf("Reranking cross_encoder queries with %s", baseURL)
+	return &rag.HTTPReranker{
+		BaseURL: baseURL,
+		APIKey:  os.Getenv("RERANK_API_KEY"),
+		Model:   os.Getenv("RERANK_MODEL"),
+	}
+}
+
+// queryDefaults reads the QUERY_* environment variables, which set the
+// retrieval options of requests that leave them out.
+func queryDefaults() types.QueryRequest {
+	def := types.QueryRequest{
+		RetrievalMode: os.Getenv("QUERY_RETRIEVAL_MODE"),
+		Diversity:     os.Getenv("QUERY_DIVERSITY"),
+		Rerank:        os.Getenv("QUERY_RERANK"),
+	}
+	def.TopK = envInt("QUERY_TOP_K")
+	def.MinScore = envFloat("QUERY_MIN_SCORE")
+	def.MMRLambda = envFloat("QUERY_MMR_LAMBDA")
+	def.Expand = envInt("QUERY_EXPAND")
+	def.RerankDepth = envInt("QUERY_RERANK_DEPTH")
+	if err := rag.ValidateQuery(def); err != nil {
+		log.Fatalf("invalid QUERY_* defaults: %v", err)
+	}
+	return def
+}
+
+// envInt parses the integer environment variable key, or returns nil if it
+// is unset.
+func envInt(key string) *int {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return &n
+}
+
+// envFloat is envInt for float32 values.
+func envFloat(key string) *float32 {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 32)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	f32 := float32(f)
+	return &f32
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// parseHashing reads the HASH_SIGNED and HASH_FUNCTIONS settings; empty
+// values keep the defaults.
+func parseHashing(signed, hashes string) (embeddings.FeatureHashing, error) {
+	var f embeddings.FeatureHashing
+	var err error
+	if signed != "" {
+		if f.Signed, err = strconv.ParseBool(signed); err != nil {
+			return f, fmt.Errorf("HASH_SIGNED: %w", err)
+		}
+	}
+	if hashes != "" {
+		if f.Hashes, err = strconv.Atoi(hashes); err != nil || f.Hashes < 1 {
+			return f, fmt.Errorf("HASH_FUNCTIONS must be a positive integer, got %q", hashes)
+		}
+	}
+	return f, nil
+}
+
+// newEmbedder returns the named embedder. A TF-IDF embedder keeps its
+// fitted statistics next to a persistent index; remote embedders are
+// configured by EMBEDDING_* environment variables.
+func newEmbedder(name, indexDir string, opts embeddings.HashOptions) embeddings.Embedder {
+	if name == "openai" || name == "ollama" {
+		return newRemoteEmbedder(name)
+	}
+	if name == "tfidf" && indexDir != "" {
+		e, err := embeddings.OpenTFIDFEmbedder(filepath.Join(indexDir, "tfidf.json"), opts)
+		if err != nil {
+			log.Fatalf("failed to load embedder: %v", err)
+		}
+		return e
+	}
+	e, err := embeddings.New(name, opts)
+	if err != nil {
+		log.Fatalf("invalid EMBEDDER: %v", err)
+	}
+	return e
+}
+
+// newRemoteEmbedder returns an OpenAI-compatible or Ollama embedder whose
+// dimension is known, so it can be recorded in the index header.
+func newRemoteEmbedder(provider string) embeddings.Embedder {
+	cfg := embeddings.RemoteConfig{
+		BaseURL: os.Getenv("EMBEDDING_BASE_URL"),
+		Model:   os.Getenv("EMBEDDING_MODEL"),
+	}
+	if provider == "openai" {
+		cfg.APIKey = envOr("EMBEDDING_API_KEY", os.Getenv("OPENAI_API_KEY"))
+		if cfg.Model == "" {
+			cfg.Model = "text-embedding-3-small"
+		}
+	} else if cfg.Model == "" {
+		cfg.Model = "nomic-embed-text"
+	}
+	if v := os.Getenv("EMBEDDING_DIM"); v != "" {
+		dim, err := strconv.Atoi(v)
+		if err != nil || dim <= 0 {
+			log.Fatalf("invalid EMBEDDING_DIM %q", v)
+		}
+		cfg.Dim = dim
+	}
+	e, err := embeddings.NewRemote(provider, cfg)
+	if err != nil {
+		log.Fatalf("invalid EMBEDDER: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	dim, err := e.DetectDimension(ctx)
+	if err != nil {
+		log.Fatalf("failed to reach embedding model: %v", err)
+	}
+	log.Printf("Embedding with %s (%d dimensions)", e.Name(), dim)
+	return e
+}
+
+// openStore returns an in-memory store, or a persistent one when indexDir is
+// set. VECTOR_STORE=hnsw serves searches from an approximate HNSW graph
+// instead of an exact scan.
+func openStore(indexDir string, metric store.Metric, embedder embeddings.Embedder) store.VectorStore {
+	score, err := store.ScorerFor(metric)
+	if err != nil {
+		log.Fatalf("failed to create vector store: %v", err)
+	}
+	var index store.SearchIndex
+	switch kind := os.Getenv("VECTOR_STORE"); kind {
+	case "", "exact":
+		index = store.NewMemoryStoreWithScorer(score)
+	case "hnsw":
+		cfg := store.DefaultHNSWConfig()
+		cfg.Score = score
+		if ef := envInt("HNSW_EF_SEARCH"); ef != nil {
+			if *ef <= 0 {
+				log.Fatalf("invalid HNSW_EF_SEARCH: must be positive, got %d", *ef)
+			}
+			cfg.EfSearch = *ef
+		}
+		index = store.NewHNSWStore(cfg)
+		log.Printf("Searching an HNSW index (ef_search=%d)", cfg.EfSearch)
+	default:
+		log.Fatalf("invalid VECTOR_STORE %q: want exact or hnsw", kind)
+	}
+	if indexDir == "" {
+		return index
+	}
+
+	ds, err := store.OpenDiskStoreWithIndex(indexDir, store.IndexMeta{
+		Embedder:  embedder.Name(),
+		Dimension: embedder.Dimension(),
+	}, index)
+	if err != nil {
+		log.Fatalf("failed to open index in %s: %v", indexDir, err)
+	}
+	log.Printf("Using persistent index in %s", indexDir)
+	for _, bookID := range ds.DroppedBooks() {
+		log.Printf("Dropped partially ingested book %s from the index", bookID)
+	}
+	return ds
+}
+
+func hasBook(pipeline *rag.Pipeline, bookID string) bool {
+	books, err := pipeline.ListBooks()
+	if err != nil {
+		log.Fatalf("failed to list books: %v", err)
+	}
+	for _, b := range books {
+		if b.BookID == bookID {
+			return true
+		}
+	}
+	return false
+}
+
+func ingestBook(pipeline *rag.Pipeline, bookPath, bookID string, chunker rag.ChunkStrategy) {
+	log.Printf("Loading book from: %s (bookID=%s)", bookPath, bookID)
+	bookText := mustReadBook(bookPath)
+
+	// Ctrl-C aborts the ingestion cleanly: chunks added so far are removed
+	// so a persistent index does not keep a partial book.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	log.Printf("Ingesting book into vector store...")
+	res, err := pipeline.IngestBook(ctx, bookID, bookText, rag.IngestConfig{
+		ChunkSize:        800,
+		ChunkOverlap:     200,
+		MaxChunks:        0,
+		NormalizeSpaces:  true,
+		Chunker:          chunker,
+		StripBoilerplate: os.Getenv("KEEP_BOILERPLATE") == "",
+	})
+	if err != nil {
+		log.Fatalf("failed to ingest book: %v", err)
+	}
+	log.Printf("Ingested %d chunks", res.Chunks)
+	if st := res.Stripped; st.Header || st.Footer || st.TranscriberNotes > 0 || st.ContentsLines > 0 {
+		log.Printf("Stripped boilerplate: header=%d chars, footer=%d chars, transcriber notes=%d, contents lines=%d",
+			st.HeaderChars, st.FooterChars, st.TranscriberNotes, st.ContentsLines)
+	}
+}
@@ -0,0 +1,119 @@
+package analysis
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Analyzer turns text into index terms. The zero value only tokenizes.
+type Analyzer struct {
+	Stem      bool // reduce words to their Porter stem
+	Stopwords bool // drop English stopwords
+	// Bigrams adds a term for each pair of adjacent words left after
+	// stopword removal, e.g. "march_hare".
+	Bigrams bool
+	// CharNGrams, if > 0, adds the character n-grams of each word padded
+	// with ^ and $, so misspellings still share most terms.
+	CharNGrams int
+}
+
+// ParseAnalyzer resolves a spec such as "stem+stop+bigrams+char3". The
+// empty string and "plain" give the zero Analyzer.
+func ParseAnalyzer(spec string) (Analyzer, error) {
+	var a Analyzer
+	for _, part := range strings.FieldsFunc(strings.ToLower(spec), func(r rune) bool { return r == '+' || r == ',' }) {
+		switch part = strings.TrimSpace(part); {
+		case part == "plain":
+		case part == "stem":
+			a.Stem = true
+		case part == "stop" || part == "stopwords":
+			a.Stopwords = true
+		case part == "bigram" || part == "bigrams":
+			a.Bigrams = true
+		case strings.HasPrefix(part, "char"):
+			n, err := strconv.Atoi(strings.TrimPrefix(part, "char"))
+			if err != nil || n < 2 || n > 6 {
+				return a, fmt.Errorf("invalid character n-gram size in %q (want char2 to char6)", part)
+			}
+			a.CharNGrams = n
+		default:
+			return a, fmt.Errorf("unknown analyzer option %q", part)
+		}
+	}
+	return a, nil
+}
+
+// Name returns the canonical spec, which ParseAnalyzer accepts.
+func (a Analyzer) Name() string {
+	var parts []string
+	if a.Stem {
+		parts = append(parts, "stem")
+	}
+	if a.Stopwords {
+		parts = append(parts, "stop")
+	}
+	if a.Bigrams {
+		parts = append(parts, "bigrams")
+	}
+	if a.CharNGrams > 0 {
+		parts = append(parts, "char"+strconv.Itoa(a.CharNGrams))
+	}
+	if len(parts) == 0 {
+		return "plain"
+	}
+	return strings.Join(parts, "+")
+}
+
+// Analyze returns the terms of text: words (stemmed if enabled), then
+// bigrams of the same, possibly stemmed, words, then character n-grams of
+// the unstemmed words. Bigram and n-gram terms contain "_" or "#", which
+// never occur in words, so they cannot collide with them.
+func (a Analyzer) Analyze(text string) []string {
+	words := Tokenize(text)
+	if a.Stopwords {
+		words = RemoveStopwords(words)
+	}
+
+	var grams []string
+	if a.CharNGrams > 0 {
+		for _, w := range words {
+			grams = appendCharNGrams(grams, w, a.CharNGrams)
+		}
+	}
+
+	if a.Stem {
+		// In place: bigrams are built from the stems, so "mad_hatters"
+		// matches "mad_hatter".
+		for i, w := range words {
+			words[i] = Stem(w)
+		}
+	}
+	terms := slices.Clip(words)
+	if a.Bigrams {
+		for i := 1; i < len(words); i++ {
+			terms = append(terms, words[i-1]+"_"+words[i])
+		}
+	}
+	return append(terms, grams...)
+}
+
+func appendCharNGrams(dst []string, word string, n int) []string {
+	runes := []rune("^" + word + "$")
+	for i := 0; i+n <= len(runes); i++ {
+		dst = append(dst, "#"+string(runes[i:i+n]))
+	}
+	return dst
+}
+
+// IsBigram reports whether term is a bigram produced by Analyze.
+func IsBigram(term string) bool {
+	return strings.Contains(term, "_")
+}
+
+// IsCharNGram reports whether term is a character n-gram produced by
+// Analyze.
+func IsCharNGram(term string) bool {
+	return strings.HasPrefix(term, "#")
+}
@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Analyzer
+		text string
+		want []string
+	}{
+		{
+			name: "plain",
+			text: "The Mad Hatter's tea-party!",
+			want: []string{"the", "mad", "hatter", "s", "tea", "party"},
+		},
+		{
+			name: "stopwords",
+			a:    Analyzer{Stopwords: true},
+			text: "She was down in the rabbit hole",
+			want: []string{"rabbit", "hole"},
+		},
+		{
+			name: "stem",
+			a:    Analyzer{Stem: true},
+			text: "running rabbits",
+			want: []string{"run", "rabbit"},
+		},
+		{
+			// Bigrams skip over removed stopwords.
+			name: "bigrams",
+			a:    Analyzer{Stopwords: true, Bigrams: true},
+			text: "the March Hare and the Hatter",
+			want: []string{"march", "hare", "hatter", "march_hare", "hare_hatter"},
+		},
+		{
+			name: "stemmed bigrams",
+			a:    Analyzer{Stem: true, Bigrams: true},
+			text: "mad hatters",
+			want: []string{"mad", "hatter", "mad_hatter"},
+		},
+		{
+			name: "char n-grams",
+			a:    Analyzer{CharNGrams: 3},
+			text: "Tea",
+			want: []string{"tea", "#^te", "#tea", "#ea$"},
+		},
+		{
+			// N-grams come from the unstemmed words.
+			name: "everything",
+			a:    Analyzer{Stem: true, Stopwords: true, Bigrams: true, CharNGrams: 4},
+			text: "the cats sat",
+			want: []string{"cat", "sat", "cat_sat", "#^cat", "#cats", "#ats$", "#^sat", "#sat$"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Analyze(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Analyze(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAnalyzerRoundTrip(t *testing.T) {
+	for _, spec := range []string{"plain", "stem", "stop", "stem+stop+bigrams+char3"} {
+		a, err := ParseAnalyzer(spec)
+		if err != nil {
+			t.Fatalf("ParseAnalyzer(%q): %v", spec, err)
+		}
+		if a.Name() != spec {
+			t.Errorf("ParseAnalyzer(%q).Name() = %q", spec, a.Name())
+		}
+	}
+	for _, spec := range []string{"char1", "char7", "lemma"} {
+		if _, err := ParseAnalyzer(spec); err == nil {
+			t.Errorf("ParseAnalyzer(%q) succeeded", spec)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package analysis
+
+// Stem reduces an English word to its Porter stem, e.g. "executions" and
+// "execution" both become "execut". Words of two letters or fewer and words
+// containing anything but a-z are returned unchanged.
+//
+// This follows Martin Porter's reference implementation of the 1980
+// algorithm, including its departures from the paper (bli->ble, logi->log).
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	z := &stemmer{b: []byte(word), k: len(word) - 1}
+	z.step1ab()
+	if z.k > 0 {
+		z.step1c()
+		z.step2()
+		z.step3()
+		z.step4()
+		z.step5()
+	}
+	return string(z.b[:z.k+1])
+}
+
+// stemmer holds the word being stemmed in b[0..k]; j marks the end of the
+// stem before a matched suffix.
+type stemmer struct {
+	b    []byte
+	k, j int
+}
+
+// cons reports whether b[i] is a consonant.
+func (z *stemmer) cons(i int) bool {
+	switch z.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !z.cons(i-1)
+	}
+	return true
+}
+
+// m counts the consonant-vowel sequences in b[0..j]: <c>(vc)^m<v>.
+func (z *stemmer) m() int {
+	n, i := 0, 0
+	for {
+		if i > z.j {
+			return n
+		}
+		if !z.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > z.j {
+				return n
+			}
+			if z.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > z.j {
+				return n
+			}
+			if !z.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+func (z *stemmer) vowelInStem() bool {
+	for i := 0; i <= z.j; i++ {
+		if !z.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec reports whether b[j-1..j] is a double consonant.
+func (z *stemmer) doublec(j int) bool {
+	return j >= 1 && z.b[j] == z.b[j-1] && z.cons(j)
+}
+
+// cvc reports whether b[i-2..i] is consonant-vowel-consonant and the last
+// consonant is not w, x or y, as in "hop" but not "snow".
+func (z *stemmer) cvc(i int) bool {
+	if i < 2 || !z.cons(i) || z.cons(i-1) || !z.cons(i-2) {
+		return false
+	}
+	switch z.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether b[0..k] ends with s and, if so, sets j before it.
+func (z *stemmer) ends(s string) bool {
+	l := len(s)
+	if l > z.k+1 || string(z.b[z.k-l+1:z.k+1]) != s {
+		return false
+	}
+	z.j = z.k - l
+	return true
+}
+
+// setTo replaces b[j+1..k] with s.
+func (z *stemmer) setTo(s string) {
+	z.b = append(z.b[:z.j+1], s...)
+	z.k = z.j + len(s)
+}
+
+func (z *stemmer) replaceIfMeasured(s string) {
+	if z.m() > 0 {
+		z.setTo(s)
+	}
+}
+
+// replaceFirst applies the first rule whose suffix matches, if the stem
+// before it has m > 0.
+func (z *stemmer) replaceFirst(rules [][2]string) {
+	for _, r := range rules {
+		if z.ends(r[0]) {
+			z.replaceIfMeasured(r[1])
+			return
+		}
+	}
+}
+
+// step1ab removes plurals and -ed or -ing.
+func (z *stemmer) step1ab() {
+	if z.b[z.k] == 's' {
+		switch {
+		case z.ends("sses"):
+			z.k -= 2
+		case z.ends("ies"):
+			z.setTo("i")
+		case z.b[z.k-1] != 's':
+			z.k--
+		}
+	}
+	if z.ends("eed") {
+		if z.m() > 0 {
+			z.k--
+		}
+		return
+	}
+	if (z.ends("ed") || z.ends("ing")) && z.vowelInStem() {
+		z.k = z.j
+		switch {
+		case z.ends("at"):
+			z.setTo("ate")
+		case z.ends("bl"):
+			z.setTo("ble")
+		case z.ends("iz"):
+			z.setTo("ize")
+		case z.doublec(z.k):
+			z.k--
+			switch z.b[z.k] {
+			case 'l', 's', 'z':
+				z.k++
+			}
+		case z.m() == 1 && z.cvc(z.k):
+			z.setTo("e")
+		}
+	}
+}
+
+// step1c turns a terminal y into i when there is another vowel in the stem.
+func (z *stemmer) step1c() {
+	if z.ends("y") && z.vowelInStem() {
+		z.b[z.k] = 'i'
+	}
+}
+
+// step2 maps double suffixes to single ones, e.g. -ization to -ize.
+func (z *stemmer) step2() {
+	switch z.b[z.k-1] {
+	case 'a':
+		z.replaceFirst([][2]string{{"ational", "ate"}, {"tional", "tion"}})
+	case 'c':
+		z.replaceFirst([][2]string{{"enci", "ence"}, {"anci", "ance"}})
+	case 'e':
+		z.replaceFirst([][2]string{{"izer", "ize"}})
+	case 'l':
+		z.replaceFirst([][2]string{{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"}})
+	case 'o':
+		z.replaceFirst([][2]string{{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}})
+	case 's':
+		z.replaceFirst([][2]string{{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"}})
+	case 't':
+		z.replaceFirst([][2]string{{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}})
+	case 'g':
+		z.replaceFirst([][2]string{{"logi", "log"}})
+	}
+}
+
+// step3 handles -ic-, -full, -ness and similar.
+func (z *stemmer) step3() {
+	switch z.b[z.k] {
+	case 'e':
+		z.replaceFirst([][2]string{{"icate", "ic"}, {"ative", ""}, {"alize", "al"}})
+	case 'i':
+		z.replaceFirst([][2]string{{"iciti", "ic"}})
+	case 'l':
+		z.replaceFirst([][2]string{{"ical", "ic"}, {"ful", ""}})
+	case 's':
+		z.replaceFirst([][2]string{{"ness", ""}})
+	}
+}
+
+// step4 removes -ant, -ence and similar when the stem has m > 1.
+func (z *stemmer) step4() {
+	var suffixes []string
+	switch z.b[z.k-1] {
+	case 'a':
+		suffixes = []string{"al"}
+	case 'c':
+		suffixes = []string{"ance", "ence"}
+	case 'e':
+		suffixes = []string{"er"}
+	case 'i':
+		suffixes = []string{"ic"}
+	case 'l':
+		suffixes = []string{"able", "ible"}
+	case 'n':
+		suffixes = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if z.ends("ion") && z.j >= 0 && (z.b[z.j] == 's' || z.b[z.j] == 't') {
+			break
+		}
+		suffixes = []string{"ou"}
+	case 's':
+		suffixes = []string{"ism"}
+	case 't':
+		suffixes = []string{"ate", "iti"}
+	case 'u':
+		suffixes = []string{"ous"}
+	case 'v':
+		suffixes = []string{"ive"}
+	case 'z':
+		suffixes = []string{"ize"}
+	default:
+		return
+	}
+	if suffixes != nil {
+		matched := false
+		for _, s := range suffixes {
+			if z.ends(s) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+	}
+	if z.m() > 1 {
+		z.k = z.j
+	}
+}
+
+// step5 removes a final -e and reduces -ll when m > 1.
+func (z *stemmer) step5() {
+	z.j = z.k
+	if z.b[z.k] == 'e' {
+		a := z.m()
+		if a > 1 || a == 1 && !z.cvc(z.k-1) {
+			z.k--
+		}
+	}
+	if z.b[z.k] == 'l' && z.doublec(z.k) && z.m() > 1 {
+		z.k--
+	}
+}
@@ -0,0 +1,55 @@
+package analysis
+
+import "testing"
+
+// The examples of each step in Porter's paper, stemmed all the way, as the
+// reference implementation does.
+func TestStem(t *testing.T) {
+	tests := []struct {
+		step  string
+		words map[string]string
+	}{
+		{"1a", map[string]string{
+			"caresses": "caress", "ponies": "poni", "ties": "ti", "caress": "caress", "cats": "cat",
+		}},
+		{"1b", map[string]string{
+			"feed": "feed", "agreed": "agre", "plastered": "plaster", "bled": "bled",
+			"motoring": "motor", "sing": "sing", "conflated": "conflat", "troubled": "troubl",
+			"sized": "size", "hopping": "hop", "tanned": "tan", "falling": "fall",
+			"hissing": "hiss", "fizzed": "fizz", "failing": "fail", "filing": "file",
+		}},
+		{"1c", map[string]string{"happy": "happi", "sky": "sky"}},
+		{"2", map[string]string{
+			"relational": "relat", "conditional": "condit", "rational": "ration",
+			"valenci": "valenc", "hesitanci": "hesit", "digitizer": "digit",
+			"conformabli": "conform", "radicalli": "radic", "differentli": "differ",
+			"vileli": "vile", "analogousli": "analog", "vietnamization": "vietnam",
+			"predication": "predic", "operator": "oper", "feudalism": "feudal",
+			"decisiveness": "decis", "hopefulness": "hope", "callousness": "callous",
+			"formaliti": "formal", "sensitiviti": "sensit", "sensibiliti": "sensibl",
+		}},
+		{"3", map[string]string{
+			"triplicate": "triplic", "formative": "form", "formalize": "formal",
+			"electriciti": "electr", "electrical": "electr", "hopeful": "hope", "goodness": "good",
+		}},
+		{"4", map[string]string{
+			"revival": "reviv", "allowance": "allow", "inference": "infer", "airliner": "airlin",
+			"gyroscopic": "gyroscop", "adjustable": "adjust", "defensible": "defens",
+			"irritant": "irrit", "replacement": "replac", "adjustment": "adjust",
+			"dependent": "depend", "adoption": "adopt", "homologou": "homolog",
+			"communism": "commun", "activate": "activ", "angulariti": "angular",
+			"homologous": "homolog", "effective": "effect", "bowdlerize": "bowdler",
+		}},
+		{"5", map[string]string{
+			"probate": "probat", "rate": "rate", "cease": "ceas", "controll": "control", "roll": "roll",
+		}},
+		{"unchanged", map[string]string{"is": "is", "as": "as", "café": "café", "r2d2": "r2d2"}},
+	}
+	for _, tt := range tests {
+		for word, want := range tt.words {
+			if got := Stem(word); got != want {
+				t.Errorf("step %s: Stem(%q) = %q, want %q", tt.step, word, got, want)
+			}
+		}
+	}
+}
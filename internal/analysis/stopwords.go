@@ -0,0 +1,41 @@
+package analysis
+
+// englishStopwords are common function words that carry little meaning for
+// retrieval.
+var englishStopwords = map[string]bool{}
+
+func init() {
+	for _, w := range []string{
+		"a", "about", "above", "after", "again", "against", "all", "am", "an", "and",
+		"any", "are", "as", "at", "be", "because", "been", "before", "being", "below",
+		"between", "both", "but", "by", "can", "could", "did", "do", "does", "doing",
+		"down", "during", "each", "few", "for", "from", "further", "had", "has", "have",
+		"having", "he", "her", "here", "hers", "herself", "him", "himself", "his", "how",
+		"i", "if", "in", "into", "is", "it", "its", "itself", "just", "me", "more", "most",
+		"my", "myself", "no", "nor", "not", "now", "of", "off", "on", "once", "only", "or",
+		"other", "our", "ours", "ourselves", "out", "over", "own", "s", "same", "she",
+		"should", "so", "some", "such", "t", "than", "that", "the", "their", "theirs",
+		"them", "themselves", "then", "there", "these", "they", "this", "those", "through",
+		"to", "too", "under", "until", "up", "very", "was", "we", "were", "what", "when",
+		"where", "which", "while", "who", "whom", "why", "will", "with", "would", "you",
+		"your", "yours", "yourself", "yourselves",
+	} {
+		englishStopwords[w] = true
+	}
+}
+
+// IsStopword reports whether a lowercased token is an English stopword.
+func IsStopword(token string) bool {
+	return englishStopwords[token]
+}
+
+// RemoveStopwords returns tokens without stopwords, reusing the slice.
+func RemoveStopwords(tokens []string) []string {
+	out := tokens[:0]
+	for _, t := range tokens {
+		if !englishStopwords[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,26 @@
+package analysis
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenize lowercases text and splits it into runs of letters and digits.
+func Tokenize(text string) []string {
+	var b strings.Builder
+	var tokens []string
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			if b.Len() > 0 {
+				tokens = append(tokens, b.String())
+				b.Reset()
+			}
+		}
+	}
+	if b.Len() > 0 {
+		tokens = append(tokens, b.String())
+	}
+	return tokens
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ragbook/internal/rag"
+)
+
+// maxBookBytes bounds the size of an uploaded book.
+const maxBookBytes = 64 << 20
+
+var bookIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// ingestRequest is the JSON body of POST /api/v1/books.
+type ingestRequest struct {
+	BookID string `json:"book_id"`
+	Text   string `json:"text"`
+	rag.IngestConfig
+	// Overlap shadows IngestConfig.ChunkOverlap so an omitted overlap can
+	// be scaled to the chunk size.
+	Overlap *int `json:"chunk_overlap"`
+}
+
+// config returns the ingest config, with a default overlap of a quarter of
+// the chunk size when none was given.
+func (req ingestRequest) config() rag.IngestConfig {
+	cfg := req.IngestConfig
+	if req.Overlap != nil {
+		cfg.ChunkOverlap = *req.Overlap
+	} else {
+		size := cfg.ChunkSize
+		if size <= 0 {
+			size = defaultChunkSize
+		}
+		cfg.ChunkOverlap = size / 4
+	}
+	return cfg
+}
+
+// defaultChunkSize is the chunk size the server uses for BOOK_PATH; with the
+// default overlap of a quarter of it, uploads are chunked the same way.
+const defaultChunkSize = 800
+
+func defaultIngestConfig() rag.IngestConfig {
+	return rag.IngestConfig{
+		ChunkSize:        defaultChunkSize,
+		NormalizeSpaces:  true,
+		StripBoilerplate: true,
+	}
+}
+
+// booksHandler serves GET (list) and POST (ingest) on /api/v1/books.
+func booksHandler(pipeline *rag.Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			books, err := pipeline.ListBooks()
+			if err != nil {
+				log.Printf("error listing books: %v", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, books)
+		case http.MethodPost:
+			ingestBook(pipeline, w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// bookHandler serves DELETE on /api/v1/books/{id}.
+func bookHandler(pipeline *rag.Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.PathValue("id")
+		n, err := pipeline.DeleteBook(id)
+		if errors.Is(err, rag.ErrBookNotFound) {
+			http.Error(w, "book not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("error deleting book %s: %v", id, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"book_id": id, "deleted_chunks": n})
+	})
+}
+
+func ingestBook(pipeline *rag.Pipeline, w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBookBytes)
+
+	var req ingestRequest
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		req, err = parseMultipartIngest(r)
+	} else {
+		req = ingestRequest{IngestConfig: defaultIngestConfig()}
+		err = json.NewDecoder(r.Body).Decode(&req)
+	}
+	if err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !bookIDRe.MatchString(req.BookID) {
+		http.Error(w, "book_id must be 1-128 letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		http.Error(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := rag.ParseChunkStrategy(string(req.Chunker)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg := req.config()
+	if cfg.ChunkSize < 0 || cfg.ChunkOverlap < 0 {
+		http.Error(w, "chunk_size and chunk_overlap must be non-negative", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+	defer cancel()
+
+	res, err := pipeline.IngestBook(ctx, req.BookID, req.Text, cfg)
+	if errors.Is(err, rag.ErrBookExists) {
+		http.Error(w, "book already exists", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, rag.ErrInvalidConfig) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("ingesting book %s timed out: %v", req.BookID, err)
+		http.Error(w, "ingestion timed out", http.StatusGatewayTimeout)
+		return
+	}
+	if err != nil {
+		log.Printf("error ingesting book %s: %v", req.BookID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// parseMultipartIngest reads a "file" upload plus optional form fields named
+// like the JSON body. book_id defaults to the file name without extension.
+func parseMultipartIngest(r *http.Request) (ingestRequest, error) {
+	req := ingestRequest{IngestConfig: defaultIngestConfig()}
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		return req, err
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return req, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return req, err
+	}
+	req.Text = string(data)
+
+	req.BookID = r.FormValue("book_id")
+	if req.BookID == "" {
+		req.BookID = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+	if v := r.FormValue("chunker"); v != "" {
+		req.Chunker = rag.ChunkStrategy(v)
+	}
+	if v := r.FormValue("metadata"); v != "" {
+		if err := json.Unmarshal([]byte(v), &req.Metadata); err != nil {
+			return req, errors.New("metadata must be a JSON object of strings")
+		}
+	}
+	if v := r.FormValue("chunk_overlap"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return req, errors.New("chunk_overlap must be an integer")
+		}
+		req.Overlap = &n
+	}
+	for name, dst := range map[string]*int{
+		"chunk_size": &req.ChunkSize,
+		"max_chunks": &req.MaxChunks,
+	} {
+		if v := r.FormValue(name); v != "" {
+			if *dst, err = strconv.Atoi(v); err != nil {
+				return req, errors.New(name + " must be an integer")
+			}
+		}
+	}
+	for name, dst := range map[string]*bool{
+		"normalize_spaces":  &req.NormalizeSpaces,
+		"strip_boilerplate": &req.StripBoilerplate,
+	} {
+		if v := r.FormValue(name); v != "" {
+			if *dst, err = strconv.ParseBool(v); err != nil {
+				return req, errors.New(name + " must be a boolean")
+			}
+		}
+	}
+	return req, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error encoding response: %v", err)
+	}
+}
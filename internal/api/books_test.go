@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ragbook/internal/embeddings"
+	"ragbook/internal/rag"
+	"ragbook/internal/store"
+)
+
+func newTestRouter() (http.Handler, *rag.Pipeline) {
+	p := rag.NewPipeline(store.NewMemoryStore(), embeddings.NewHashEmbedder(64))
+	return NewRouter(p), p
+}
+
+func postJSON(t *testing.T, h http.Handler, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data)))
+	return rec
+}
+
+func TestIngestBookOverlap(t *testing.T) {
+	text := strings.Repeat("Down the rabbit hole she went. ", 40)
+	tests := []struct {
+		name        string
+		body        map[string]any
+		wantStatus  int
+		wantOverlap int
+	}{
+		{"overlap larger than default size", map[string]any{"chunk_size": 0, "chunk_overlap": 900}, http.StatusBadRequest, 0},
+		{"overlap equal to size", map[string]any{"chunk_size": 100, "chunk_overlap": 100}, http.StatusBadRequest, 0},
+		{"size only scales the overlap", map[string]any{"chunk_size": 100}, http.StatusCreated, 25},
+		{"defaults", map[string]any{}, http.StatusCreated, 200},
+		{"explicit zero overlap", map[string]any{"chunk_size": 100, "chunk_overlap": 0}, http.StatusCreated, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, p := newTestRouter()
+			tt.body["book_id"], tt.body["text"] = "alice", text
+			rec := postJSON(t, h, "/api/v1/books", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d (%s), want %d", rec.Code, strings.TrimSpace(rec.Body.String()), tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+			books, _ := p.ListBooks()
+			if len(books) != 1 || books[0].Config.ChunkOverlap != tt.wantOverlap {
+				t.Errorf("books = %+v, want overlap %d", books, tt.wantOverlap)
+			}
+		})
+	}
+}
+
+func TestIngestBookMultipartOverlap(t *testing.T) {
+	h, _ := newTestRouter()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "alice.txt")
+	fw.Write([]byte(strings.Repeat("Curiouser and curiouser! ", 40)))
+	mw.WriteField("chunk_size", "0")
+	mw.WriteField("chunk_overlap", "900")
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/books", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d (%s), want 400", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+}
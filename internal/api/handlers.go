@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -13,18 +14,12 @@ import (
 
 func queryHandler(pipeline *rag.Pipeline) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		req, ok := decodeQuery(w, r)
+		if !ok {
 			return
 		}
-
-		var req types.QueryRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid JSON body", http.StatusBadRequest)
-			return
-		}
-		if req.Query == "" {
-			http.Error(w, "query is required", http.StatusBadRequest)
+		if acceptsEventStream(r) {
+			streamQuery(w, r, pipeline, req)
 			return
 		}
 
@@ -32,6 +27,15 @@ func queryHandler(pipeline *rag.Pipeline) http.Handler {
 		defer cancel()
 
 		resp, err := pipeline.AnswerQuery(ctx, req)
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("query timed out: %v", err)
+			http.Error(w, "query timed out", http.StatusGatewayTimeout)
+			return
+		}
+		if errors.Is(err, rag.ErrInvalidQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			log.Printf("error answering query: %v", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
@@ -44,3 +48,35 @@ func queryHandler(pipeline *rag.Pipeline) http.Handler {
 		}
 	})
 }
+
+// queryStreamHandler always answers with server-sent events.
+func queryStreamHandler(pipeline *rag.Pipeline) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if req, ok := decodeQuery(w, r); ok {
+			streamQuery(w, r, pipeline, req)
+		}
+	})
+}
+
+// decodeQuery reads and validates a query request, replying with an error
+// and returning false if it is invalid.
+func decodeQuery(w http.ResponseWriter, r *http.Request) (types.QueryRequest, bool) {
+	var req types.QueryRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Query == "" {
+		http.Error(w, "query is required", http.StatusBadRequest)
+		return req, false
+	}
+	if err := rag.ValidateQuery(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
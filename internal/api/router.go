@@ -15,6 +15,9 @@ func NewRouter(pipeline *rag.Pipeline) http.Handler {
 	})
 
 	mux.Handle("/api/v1/query", queryHandler(pipeline))
+	mux.Handle("/api/v1/query/stream", queryStreamHandler(pipeline))
+	mux.Handle("/api/v1/books", booksHandler(pipeline))
+	mux.Handle("/api/v1/books/{id}", bookHandler(pipeline))
 
 	return mux
 }
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"ragbook/internal/rag"
+	"ragbook/internal/types"
+)
+
+// streamTimeout bounds a streamed query. It is longer than the buffered
+// query timeout because the client sees progress while the model writes.
+const streamTimeout = 2 * time.Minute
+
+// Server-sent event payloads of a streamed query.
+type (
+	sourcesEvent struct {
+		Sources []types.SourceChunk `json:"sources"`
+	}
+	deltaEvent struct {
+		Text string `json:"text"`
+	}
+	doneEvent struct {
+		RetrievalMS  int64 `json:"retrieval_ms"`
+		GenerationMS int64 `json:"generation_ms"`
+		TotalMS      int64 `json:"total_ms"`
+	}
+	errorEvent struct {
+		Error string `json:"error"`
+	}
+)
+
+// acceptsEventStream reports whether the client asked for server-sent
+// events.
+func acceptsEventStream(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(part); err == nil && mt == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// streamQuery answers req as server-sent events: one "sources" event with
+// the retrieved chunks, "delta" events with pieces of the answer and a
+// final "done" event with timings, or an "error" event if the query fails
+// after the stream has started. A client disconnect cancels the query.
+func streamQuery(w http.ResponseWriter, r *http.Request, pipeline *rag.Pipeline, req types.QueryRequest) {
+	rc := http.NewResponseController(w)
+	ctx, cancel := context.WithTimeout(r.Context(), streamTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var retrieved time.Time
+	started := false
+	send := func(event string, v any) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if !started {
+			h := w.Header()
+			h.Set("Content-Type", "text/event-stream")
+			h.Set("Cache-Control", "no-cache")
+			h.Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return err
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	err := pipeline.AnswerQueryStream(ctx, req, rag.QueryStream{
+		Sources: func(sources []types.SourceChunk) error {
+			retrieved = time.Now()
+			return send("sources", sourcesEvent{Sources: sources})
+		},
+		Delta: func(text string) error {
+			return send("delta", deltaEvent{Text: text})
+		},
+	})
+	if err == nil {
+		end := time.Now()
+		err = send("done", doneEvent{
+			RetrievalMS:  retrieved.Sub(start).Milliseconds(),
+			GenerationMS: end.Sub(retrieved).Milliseconds(),
+			TotalMS:      end.Sub(start).Milliseconds(),
+		})
+	}
+	if err == nil || r.Context().Err() != nil {
+		return // done, or the client went away
+	}
+
+	log.Printf("error streaming query: %v", err)
+	msg, status := "internal error", http.StatusInternalServerError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		msg, status = "query timed out", http.StatusGatewayTimeout
+	case errors.Is(err, rag.ErrInvalidQuery):
+		msg, status = err.Error(), http.StatusBadRequest
+	}
+	if !started {
+		http.Error(w, msg, status)
+		return
+	}
+	_ = send("error", errorEvent{Error: msg})
+}
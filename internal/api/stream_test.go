@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ragbook/internal/embeddings"
+	"ragbook/internal/rag"
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+// scriptedGenerator emits deltas, then fails with err if set, or waits for
+// the context to end if block is set. It reports the context's error on
+// stopped when it returns.
+type scriptedGenerator struct {
+	deltas  []string
+	err     error
+	block   bool
+	stopped chan error
+}
+
+func (g *scriptedGenerator) Generate(ctx context.Context, query string, sources []types.SourceChunk) (string, error) {
+	var b strings.Builder
+	err := g.GenerateStream(ctx, query, sources, func(d string) error { b.WriteString(d); return nil })
+	return b.String(), err
+}
+
+func (g *scriptedGenerator) GenerateStream(ctx context.Context, _ string, _ []types.SourceChunk, emit func(string) error) error {
+	defer func() {
+		if g.stopped != nil {
+			g.stopped <- ctx.Err()
+		}
+	}()
+	for _, d := range g.deltas {
+		if err := emit(d); err != nil {
+			return err
+		}
+	}
+	if g.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return g.err
+}
+
+type sseEvent struct {
+	name, data string
+}
+
+// readEvents parses server-sent events until the stream ends or n events
+// were read, if n > 0.
+func readEvents(t *testing.T, r io.Reader, n int) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var ev sseEvent
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			if ev.name == "" || !json.Valid([]byte(ev.data)) {
+				t.Fatalf("malformed event %+v", ev)
+			}
+			events = append(events, ev)
+			if ev = (sseEvent{}); len(events) == n {
+				return events
+			}
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+	return events
+}
+
+func names(events []sseEvent) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.name)
+	}
+	return out
+}
+
+func newStreamServer(t *testing.T, g rag.Generator) *httptest.Server {
+	t.Helper()
+	p := rag.NewPipeline(store.NewMemoryStore(), embeddings.NewHashEmbedder(64), rag.WithGenerator(g))
+	if _, err := p.IngestBook(context.Background(), "alice", "The Queen shouted off with her head.", rag.IngestConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewRouter(p))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func postStream(ctx context.Context, t *testing.T, url, body string, accept bool) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept {
+		req.Header.Set("Accept", "application/json, text/event-stream")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestStreamQuery(t *testing.T) {
+	srv := newStreamServer(t, &scriptedGenerator{deltas: []string{"Off with ", "her head"}})
+	for _, tt := range []struct {
+		path   string
+		accept bool
+	}{{"/api/v1/query/stream", false}, {"/api/v1/query", true}} {
+		resp := postStream(context.Background(), t, srv.URL+tt.path, `{"query":"who shouted?"}`, tt.accept)
+		events := readEvents(t, resp.Body, 0)
+		resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("%s: Content-Type = %q", tt.path, ct)
+		}
+		if want := []string{"sources", "delta", "delta", "done"}; !slices.Equal(names(events), want) {
+			t.Fatalf("%s: events %q, want %q", tt.path, names(events), want)
+		}
+		var delta deltaEvent
+		json.Unmarshal([]byte(events[2].data), &delta)
+		var sources sourcesEvent
+		json.Unmarshal([]byte(events[0].data), &sources)
+		if delta.Text != "her head" || len(sources.Sources) != 1 {
+			t.Errorf("%s: sources %s, second delta %s", tt.path, events[0].data, events[2].data)
+		}
+	}
+}
+
+func TestStreamQueryErrors(t *testing.T) {
+	// A failure after the stream started ends it with an error event.
+	srv := newStreamServer(t, &scriptedGenerator{deltas: []string{"Off"}, err: errors.New("model crashed")})
+	resp := postStream(context.Background(), t, srv.URL+"/api/v1/query/stream", `{"query":"who shouted?"}`, false)
+	events := readEvents(t, resp.Body, 0)
+	resp.Body.Close()
+	if want := []string{"sources", "delta", "error"}; !slices.Equal(names(events), want) {
+		t.Fatalf("events %q, want %q", names(events), want)
+	}
+	if events[2].data != `{"error":"internal error"}` {
+		t.Errorf("error event data = %s", events[2].data)
+	}
+
+	// A failure before it started is a plain HTTP error.
+	resp = postStream(context.Background(), t, srv.URL+"/api/v1/query/stream", `{"query":"who shouted?","top_k":500}`, false)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Content-Type") == "text/event-stream" {
+		t.Errorf("invalid query: status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestStreamQueryStopsOnDisconnect(t *testing.T) {
+	g := &scriptedGenerator{deltas: []string{"Off"}, block: true, stopped: make(chan error, 1)}
+	srv := newStreamServer(t, g)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp := postStream(ctx, t, srv.URL+"/api/v1/query/stream", `{"query":"who shouted?"}`, false)
+	defer resp.Body.Close()
+	if got := names(readEvents(t, resp.Body, 2)); !slices.Equal(got, []string{"sources", "delta"}) {
+		t.Fatalf("events %q before disconnecting", got)
+	}
+
+	cancel()
+	select {
+	case err := <-g.stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("generator stopped with context error %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generator still running after the client disconnected")
+	}
+}
@@ -0,0 +1,51 @@
+package embeddings
+
+import "context"
+
+// ContextEmbedder is an Embedder whose calls stop when a context is done.
+type ContextEmbedder interface {
+	Embedder
+	EmbedContext(ctx context.Context, texts []string) ([][]float32, error)
+	EmbedQueryContext(ctx context.Context, text string) ([]float32, error)
+}
+
+// adapterBatchSize is how many texts the adapter embeds between checks of
+// the context.
+const adapterBatchSize = 256
+
+// WithContext returns e itself if it is a ContextEmbedder. Otherwise it
+// wraps e so that the context is checked before each call and, for long
+// inputs, between batches of texts, which is enough to abort local
+// embedders promptly.
+func WithContext(e Embedder) ContextEmbedder {
+	if ce, ok := e.(ContextEmbedder); ok {
+		return ce
+	}
+	return contextAdapter{e}
+}
+
+type contextAdapter struct {
+	Embedder
+}
+
+func (a contextAdapter) EmbedContext(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += adapterBatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vecs, err := a.Embed(texts[start:min(start+adapterBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+func (a contextAdapter) EmbedQueryContext(ctx context.Context, text string) ([]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.EmbedQuery(text)
+}
@@ -0,0 +1,161 @@
+package embeddings
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ragbook/internal/analysis"
+)
+
+// FeatureHashing controls how terms are mapped to vector positions. The
+// zero value is the original scheme: one FNV-1a bucket per term, always +1.
+type FeatureHashing struct {
+	// Signed multiplies each contribution by a ±1 sign hash, so colliding
+	// terms cancel in expectation instead of inflating similarity.
+	Signed bool
+	// Hashes is the number of independent buckets per term (default 1).
+	// Each gets 1/Hashes of the term's weight, so two terms only fully
+	// collide if all their buckets do.
+	Hashes int
+}
+
+// FeatureWeights scales terms by kind. Zero fields mean 1.
+type FeatureWeights struct {
+	Word      float32
+	Bigram    float32
+	CharNGram float32
+}
+
+func (w FeatureWeights) of(term string) float32 {
+	var f float32
+	switch {
+	case analysis.IsBigram(term):
+		f = w.Bigram
+	case analysis.IsCharNGram(term):
+		f = w.CharNGram
+	default:
+		f = w.Word
+	}
+	if f == 0 {
+		return 1
+	}
+	return f
+}
+
+// add accumulates weight for term into vec.
+func (f FeatureHashing) add(vec []float32, term string, weight float32) {
+	if f.Hashes <= 1 && !f.Signed {
+		vec[hashIndex(term, len(vec))] += weight
+		return
+	}
+	k := max(f.Hashes, 1)
+	weight /= float32(k)
+	for i := 0; i < k; i++ {
+		idx, neg := f.bucket(term, i, len(vec))
+		if neg {
+			vec[idx] -= weight
+		} else {
+			vec[idx] += weight
+		}
+	}
+}
+
+// bucket returns the i-th position of term and whether its sign is
+// negative. The i-th hash is 64-bit FNV-1a over i followed by the term;
+// the low bits pick the position and the top bit the sign.
+func (f FeatureHashing) bucket(term string, i, dim int) (int, bool) {
+	if f.Hashes <= 1 && !f.Signed {
+		return hashIndex(term, dim), false
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte{byte(i)})
+	_, _ = h.Write([]byte(term))
+	sum := h.Sum64()
+	return int(sum % uint64(dim)), f.Signed && sum>>63 == 1
+}
+
+// buckets returns the distinct positions of term.
+func (f FeatureHashing) buckets(term string, dim int) []int {
+	var out []int
+	for i := 0; i < max(f.Hashes, 1); i++ {
+		idx, _ := f.bucket(term, i, dim)
+		if !slices.Contains(out, idx) {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+// suffix names the non-default hashing and weights, e.g. "signed,k3".
+func (o HashOptions) suffix() string {
+	var parts []string
+	if o.Hashing.Signed {
+		parts = append(parts, "signed")
+	}
+	if o.Hashing.Hashes > 1 {
+		parts = append(parts, "k"+strconv.Itoa(o.Hashing.Hashes))
+	}
+	for _, w := range []struct {
+		name string
+		v    float32
+	}{{"word", o.Weights.Word}, {"bigram", o.Weights.Bigram}, {"char", o.Weights.CharNGram}} {
+		if w.v != 0 && w.v != 1 {
+			parts = append(parts, w.name+"="+strconv.FormatFloat(float64(w.v), 'g', -1, 32))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// CollisionReport describes how distinct terms share vector positions.
+type CollisionReport struct {
+	Dim             int
+	Terms           int     // distinct terms
+	OccupiedBuckets int     // positions used by at least one term
+	CollidingTerms  int     // terms sharing every one of their positions with another term
+	Rate            float64 // CollidingTerms / Terms
+	// WeightedRate is the fraction of term occurrences that fall on fully
+	// colliding terms, which is what a query actually experiences.
+	WeightedRate float64
+}
+
+// Collisions reports the collision rate of hashing the given term counts
+// into dim positions.
+func (f FeatureHashing) Collisions(counts map[string]int, dim int) CollisionReport {
+	r := CollisionReport{Dim: dim, Terms: len(counts)}
+	if dim <= 0 || len(counts) == 0 {
+		return r
+	}
+	buckets := make(map[string][]int, len(counts))
+	load := make([]int, dim)
+	for term := range counts {
+		buckets[term] = f.buckets(term, dim)
+		for _, idx := range buckets[term] {
+			load[idx]++
+		}
+	}
+	for _, n := range load {
+		if n > 0 {
+			r.OccupiedBuckets++
+		}
+	}
+
+	var total, colliding int
+	for term, n := range counts {
+		total += n
+		shared := true
+		for _, idx := range buckets[term] {
+			shared = shared && load[idx] > 1
+		}
+		if shared {
+			r.CollidingTerms++
+			colliding += n
+		}
+	}
+	r.Rate = float64(r.CollidingTerms) / float64(r.Terms)
+	if total > 0 {
+		r.WeightedRate = float64(colliding) / float64(total)
+	}
+	return r
+}
@@ -0,0 +1,115 @@
+package embeddings
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// findTerm returns the first of "term0", "term1", … for which ok holds.
+func findTerm(t *testing.T, ok func(term string) bool) string {
+	t.Helper()
+	for i := 0; i < 10000; i++ {
+		if term := fmt.Sprintf("term%d", i); ok(term) {
+			return term
+		}
+	}
+	t.Fatal("no term found")
+	return ""
+}
+
+func TestFeatureHashingSignsCancel(t *testing.T) {
+	const dim = 8
+	f := FeatureHashing{Signed: true}
+	a := "term0"
+	idx, neg := f.bucket(a, 0, dim)
+	opposite := findTerm(t, func(term string) bool {
+		i, n := f.bucket(term, 0, dim)
+		return term != a && i == idx && n != neg
+	})
+	same := findTerm(t, func(term string) bool {
+		i, n := f.bucket(term, 0, dim)
+		return term != a && i == idx && n == neg
+	})
+
+	vec := make([]float32, dim)
+	f.add(vec, a, 1)
+	f.add(vec, opposite, 1)
+	for i, v := range vec {
+		if v != 0 {
+			t.Errorf("colliding terms of opposite sign left %v at position %d", v, i)
+		}
+	}
+	vec = make([]float32, dim)
+	f.add(vec, a, 1)
+	f.add(vec, same, 1)
+	if math.Abs(float64(vec[idx])) != 2 {
+		t.Errorf("colliding terms of the same sign sum to %v, want ±2", vec[idx])
+	}
+
+	// About half of all terms are negative.
+	negative := 0
+	for i := 0; i < 1000; i++ {
+		if _, n := f.bucket(fmt.Sprintf("term%d", i), 0, dim); n {
+			negative++
+		}
+	}
+	if negative < 400 || negative > 600 {
+		t.Errorf("%d of 1000 terms have a negative sign", negative)
+	}
+}
+
+func TestFeatureHashingSpreadsOverKBuckets(t *testing.T) {
+	const dim = 1024
+	for _, f := range []FeatureHashing{{Hashes: 3}, {Hashes: 3, Signed: true}} {
+		term := findTerm(t, func(term string) bool { return len(f.buckets(term, dim)) == 3 })
+		vec := make([]float32, dim)
+		f.add(vec, term, 1)
+		nonzero := 0
+		var mass float64
+		for _, v := range vec {
+			if v != 0 {
+				nonzero++
+				mass += math.Abs(float64(v))
+				if math.Abs(math.Abs(float64(v))-1.0/3) > 1e-6 {
+					t.Errorf("%+v: bucket holds %v, want ±1/3", f, v)
+				}
+			}
+		}
+		if nonzero != 3 || math.Abs(mass-1) > 1e-6 {
+			t.Errorf("%+v: weight spread over %d buckets with total %v, want 3 and 1", f, nonzero, mass)
+		}
+	}
+}
+
+func TestFeatureHashingCollisions(t *testing.T) {
+	const dim = 8
+	var f FeatureHashing
+	a := "term0"
+	b := findTerm(t, func(term string) bool { return term != a && hashIndex(term, dim) == hashIndex(a, dim) })
+	c := findTerm(t, func(term string) bool { return hashIndex(term, dim) != hashIndex(a, dim) })
+
+	got := f.Collisions(map[string]int{a: 1, b: 2, c: 5}, dim)
+	want := CollisionReport{Dim: dim, Terms: 3, OccupiedBuckets: 2, CollidingTerms: 2, Rate: 2.0 / 3, WeightedRate: 3.0 / 8}
+	if got != want {
+		t.Errorf("Collisions = %+v, want %+v", got, want)
+	}
+
+	// With one bucket every term collides.
+	got = f.Collisions(map[string]int{a: 1, b: 1, c: 1}, 1)
+	if got.OccupiedBuckets != 1 || got.CollidingTerms != 3 || got.Rate != 1 {
+		t.Errorf("Collisions in 1 bucket = %+v", got)
+	}
+
+	// With two hashes a term only collides if both its buckets are shared.
+	f = FeatureHashing{Hashes: 2}
+	ab := f.buckets(a, dim)
+	d := findTerm(t, func(term string) bool {
+		bs := f.buckets(term, dim)
+		return term != a && len(ab) == 2 && len(bs) == 2 && bs[0] == ab[0] && bs[1] != ab[1] && bs[0] != ab[1] && bs[1] != ab[0]
+	})
+	got = f.Collisions(map[string]int{a: 1, d: 1}, dim)
+	if got.OccupiedBuckets != 3 || got.CollidingTerms != 0 {
+		t.Errorf("Collisions of terms sharing one of two buckets = %+v, want 3 buckets and no collisions", got)
+	}
+}
@@ -1,31 +1,68 @@
 package embeddings
 
 import (
+	"fmt"
 	"hash/fnv"
 	"strings"
-	"unicode"
+
+	"ragbook/internal/analysis"
 )
 
 // Embedder is the interface used by the RAG pipeline.
 type Embedder interface {
 	Embed(texts []string) ([][]float32, error)
 	EmbedQuery(text string) ([]float32, error)
+	// Name identifies the model, so persisted indexes can detect a mismatch.
+	Name() string
+	// Dimension is the length of the returned vectors.
+	Dimension() int
 }
 
 // HashEmbedder is a minimal, self-contained embedding model.
 // It hashes tokens into a fixed-size vector.
 type HashEmbedder struct {
-	dim int
+	opts HashOptions
+}
+
+// HashOptions configures the hashing embedders.
+type HashOptions struct {
+	Dim      int // default 512
+	Analyzer analysis.Analyzer
+	Hashing  FeatureHashing
+	Weights  FeatureWeights
+}
+
+// name returns base followed by the analyzer spec unless it is plain and
+// the hashing settings unless they are the defaults, e.g.
+// "hash:stem+stop/signed,k2".
+func (o HashOptions) name(base string) string {
+	name := withAnalyzer(base, o.Analyzer)
+	if s := o.suffix(); s != "" {
+		name += "/" + s
+	}
+	return name
 }
 
 // NewHashEmbedder creates a new hash-based embedder.
 func NewHashEmbedder(dim int) *HashEmbedder {
-	if dim <= 0 {
-		dim = 512
+	return NewHashEmbedderWithOptions(HashOptions{Dim: dim})
+}
+
+// NewHashEmbedderWithOptions creates a hash-based embedder that hashes the
+// terms produced by opts.Analyzer.
+func NewHashEmbedderWithOptions(opts HashOptions) *HashEmbedder {
+	if opts.Dim <= 0 {
+		opts.Dim = 512
 	}
-	return &HashEmbedder{dim: dim}
+	return &HashEmbedder{opts: opts}
 }
 
+// Name returns "hash" plus any non-default analyzer and hashing settings.
+func (h *HashEmbedder) Name() string { return h.opts.name("hash") }
+
+// Dimension returns the vector size.
+func (h *HashEmbedder) Dimension() int { return h.opts.Dim }
+
 // Embed multiple texts.
 func (h *HashEmbedder) Embed(texts []string) ([][]float32, error) {
 	result := make([][]float32, len(texts))
@@ -41,42 +78,23 @@ func (h *HashEmbedder) EmbedQuery(text string) ([]float32, error) {
 }
 
 func (h *HashEmbedder) embedSingle(text string) []float32 {
-	vec := make([]float32, h.dim)
-	tokens := simpleTokenize(text)
+	vec := make([]float32, h.opts.Dim)
+	tokens := h.opts.Analyzer.Analyze(text)
 	if len(tokens) == 0 {
 		return vec
 	}
 	for _, tok := range tokens {
-		idx := h.hashToken(tok)
-		vec[idx] += 1.0
+		h.opts.Hashing.add(vec, tok, h.opts.Weights.of(tok))
 	}
 	normalize(vec)
 	return vec
 }
 
-func (h *HashEmbedder) hashToken(tok string) int {
+// hashIndex maps a token to a vector position with FNV-1a.
+func hashIndex(tok string, dim int) int {
 	hasher := fnv.New32a()
 	_, _ = hasher.Write([]byte(tok))
-	return int(hasher.Sum32() % uint32(h.dim))
-}
-
-func simpleTokenize(text string) []string {
-	var b strings.Builder
-	var tokens []string
-	for _, r := range strings.ToLower(text) {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
-			b.WriteRune(r)
-		} else {
-			if b.Len() > 0 {
-				tokens = append(tokens, b.String())
-				b.Reset()
-			}
-		}
-	}
-	if b.Len() > 0 {
-		tokens = append(tokens, b.String())
-	}
-	return tokens
+	return int(hasher.Sum32() % uint32(dim))
 }
 
 func normalize(vec []float32) {
@@ -103,3 +121,25 @@ func float32Sqrt(x float32) float32 {
 	}
 	return z
 }
+
+// New returns an in-memory embedder by name, "hash" (the default) or
+// "tfidf".
+func New(name string, opts HashOptions) (Embedder, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "hash":
+		return NewHashEmbedderWithOptions(opts), nil
+	case "tfidf":
+		return NewTFIDFEmbedderWithOptions(opts), nil
+	default:
+		return nil, fmt.Errorf("unknown embedder %q", name)
+	}
+}
+
+// withAnalyzer appends a non-plain analyzer's spec to an embedder name, so
+// an index records how its text was analyzed.
+func withAnalyzer(name string, a analysis.Analyzer) string {
+	if spec := a.Name(); spec != "plain" {
+		return name + ":" + spec
+	}
+	return name
+}
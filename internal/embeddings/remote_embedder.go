@@ -0,0 +1,337 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"ragbook/internal/httpclient"
+)
+
+// RemoteConfig configures an embedder backed by a model server.
+type RemoteConfig struct {
+	BaseURL string // defaults to the provider's public or local endpoint
+	APIKey  string // sent as a bearer token if set
+	Model   string
+	// Dim is the expected vector size. If 0 it is taken from the first
+	// response; see DetectDimension.
+	Dim        int
+	BatchSize  int           // texts per request, default 64
+	MaxRetries int           // retries after 429, 5xx and network errors, default 4; < 0 for none
+	Timeout    time.Duration // per request, default 60s
+	HTTPClient *http.Client  // defaults to http.DefaultClient
+}
+
+// RemoteEmbedder embeds texts with an HTTP model server. Texts are sent in
+// batches; failed requests are retried with exponential backoff, honoring
+// Retry-After on 429 responses. Vectors are normalized like those of the
+// local embedders.
+type RemoteEmbedder struct {
+	cfg RemoteConfig
+	api remoteAPI
+	dim atomic.Int64
+}
+
+// remoteAPI is the wire format of one provider.
+type remoteAPI struct {
+	name    string
+	path    string
+	base    string
+	request func(cfg RemoteConfig, texts []string) any
+	decode  func(body []byte, n int) ([][]float32, error)
+}
+
+// NewOpenAIEmbedder returns an embedder for an OpenAI-compatible
+// /embeddings endpoint. A non-zero Dim is also sent as the "dimensions"
+// request parameter, which models that support shortening honor.
+func NewOpenAIEmbedder(cfg RemoteConfig) *RemoteEmbedder {
+	return newRemoteEmbedder(cfg, remoteAPI{
+		name:    "openai",
+		path:    "/embeddings",
+		base:    httpclient.DefaultOpenAIBaseURL,
+		request: openAIEmbeddingRequest,
+		decode:  decodeOpenAIEmbeddings,
+	})
+}
+
+// NewOllamaEmbedder returns an embedder for Ollama's /api/embed endpoint.
+func NewOllamaEmbedder(cfg RemoteConfig) *RemoteEmbedder {
+	return newRemoteEmbedder(cfg, remoteAPI{
+		name:    "ollama",
+		path:    "/api/embed",
+		base:    httpclient.DefaultOllamaBaseURL,
+		request: ollamaEmbeddingRequest,
+		decode:  decodeOllamaEmbeddings,
+	})
+}
+
+// NewRemote returns the remote embedder for provider, "openai" or "ollama".
+func NewRemote(provider string, cfg RemoteConfig) (*RemoteEmbedder, error) {
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case "openai":
+		return NewOpenAIEmbedder(cfg), nil
+	case "ollama":
+		return NewOllamaEmbedder(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q (want openai or ollama)", provider)
+	}
+}
+
+func newRemoteEmbedder(cfg RemoteConfig, api remoteAPI) *RemoteEmbedder {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = api.base
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 64
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = 4
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 60 * time.Second
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	e := &RemoteEmbedder{cfg: cfg, api: api}
+	e.dim.Store(int64(max(cfg.Dim, 0)))
+	return e
+}
+
+// Name returns the provider and model, e.g. "ollama:nomic-embed-text".
+func (e *RemoteEmbedder) Name() string { return e.api.name + ":" + e.cfg.Model }
+
+// Dimension returns the vector size, or 0 while it is still unknown.
+func (e *RemoteEmbedder) Dimension() int { return int(e.dim.Load()) }
+
+// DetectDimension returns the vector size, embedding a probe text if it is
+// not known yet.
+func (e *RemoteEmbedder) DetectDimension(ctx context.Context) (int, error) {
+	if d := e.Dimension(); d > 0 {
+		return d, nil
+	}
+	if _, err := e.EmbedQueryContext(ctx, "dimension probe"); err != nil {
+		return 0, fmt.Errorf("detect embedding dimension: %w", err)
+	}
+	return e.Dimension(), nil
+}
+
+// Embed multiple texts.
+func (e *RemoteEmbedder) Embed(texts []string) ([][]float32, error) {
+	return e.EmbedContext(context.Background(), texts)
+}
+
+// EmbedQuery embeds a single query.
+func (e *RemoteEmbedder) EmbedQuery(text string) ([]float32, error) {
+	return e.EmbedQueryContext(context.Background(), text)
+}
+
+// EmbedContext embeds texts in batches, stopping when ctx is done.
+func (e *RemoteEmbedder) EmbedContext(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.cfg.BatchSize {
+		batch := texts[start:min(start+e.cfg.BatchSize, len(texts))]
+		vecs, err := e.embedBatch(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("embed texts %d-%d: %w", start, start+len(batch)-1, err)
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+// EmbedQueryContext embeds a single query.
+func (e *RemoteEmbedder) EmbedQueryContext(ctx context.Context, text string) ([]float32, error) {
+	vecs, err := e.embedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// embedBatch sends one request, retrying transient failures.
+func (e *RemoteEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(e.api.request(e.cfg, texts))
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	for attempt := 0; ; attempt++ {
+		data, retryAfter, err := e.post(ctx, body)
+		if err == nil {
+			vecs, err := e.api.decode(data, len(texts))
+			if err != nil {
+				return nil, err
+			}
+			return vecs, e.checkDimension(vecs)
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) || ctx.Err() != nil || attempt >= e.cfg.MaxRetries {
+			return nil, err
+		}
+		wait := min(retryAfter, time.Minute)
+		if wait <= 0 {
+			wait = backoff(attempt)
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// permanentError is a response that retrying will not fix, such as 400 or
+// 401.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// post sends body and returns the response body. On a 429 or 503 response
+// it also returns the server's Retry-After delay, if any.
+func (e *RemoteEmbedder) post(ctx context.Context, body []byte) ([]byte, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	url := strings.TrimRight(e.cfg.BaseURL, "/") + e.api.path
+	resp, err := httpclient.Post(ctx, e.cfg.HTTPClient, url, httpclient.BearerHeader(e.cfg.APIKey), body)
+	var status *httpclient.StatusError
+	switch {
+	case errors.As(err, &status):
+		switch code := status.StatusCode; {
+		case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+			return nil, parseRetryAfter(status.Header.Get("Retry-After")), err
+		case code >= 500 || code == http.StatusRequestTimeout:
+			return nil, 0, err
+		default:
+			return nil, 0, &permanentError{err}
+		}
+	case err != nil:
+		return nil, 0, err
+	}
+	defer resp.Close()
+	data, err := io.ReadAll(resp)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read response: %w", err)
+	}
+	return data, 0, nil
+}
+
+// checkDimension records the vector size on first use and rejects vectors
+// of any other size afterwards.
+func (e *RemoteEmbedder) checkDimension(vecs [][]float32) error {
+	for _, v := range vecs {
+		if len(v) == 0 {
+			return &permanentError{errors.New("server returned an empty embedding")}
+		}
+		e.dim.CompareAndSwap(0, int64(len(v)))
+		if d := e.Dimension(); len(v) != d {
+			return &permanentError{fmt.Errorf("server returned %d-dimensional embeddings, want %d", len(v), d)}
+		}
+		normalize(v)
+	}
+	return nil
+}
+
+// backoff returns the delay before retry attempt+1: 500ms doubling up to
+// 30s, with up to 50% jitter so concurrent clients spread out.
+func backoff(attempt int) time.Duration {
+	d := min(500*time.Millisecond<<attempt, 30*time.Second)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(s, 0)) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ---- OpenAI /embeddings ----
+
+type openAIEmbeddingReq struct {
+	Model      string   `json:"model"`
+	Input      []string `json:"input"`
+	Dimensions int      `json:"dimensions,omitempty"`
+}
+
+type openAIEmbeddingResp struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func openAIEmbeddingRequest(cfg RemoteConfig, texts []string) any {
+	return openAIEmbeddingReq{Model: cfg.Model, Input: texts, Dimensions: cfg.Dim}
+}
+
+// decodeOpenAIEmbeddings orders the vectors by their index field, which the
+// API does not guarantee to be sequential.
+func decodeOpenAIEmbeddings(body []byte, n int) ([][]float32, error) {
+	var resp openAIEmbeddingResp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, &permanentError{fmt.Errorf("decode response: %w", err)}
+	}
+	if len(resp.Data) != n {
+		return nil, &permanentError{fmt.Errorf("server returned %d embeddings for %d texts", len(resp.Data), n)}
+	}
+	out := make([][]float32, n)
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= n || out[d.Index] != nil {
+			return nil, &permanentError{fmt.Errorf("server returned invalid embedding index %d", d.Index)}
+		}
+		out[d.Index] = d.Embedding
+	}
+	return out, nil
+}
+
+// ---- Ollama /api/embed ----
+
+type ollamaEmbedReq struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResp struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func ollamaEmbeddingRequest(cfg RemoteConfig, texts []string) any {
+	return ollamaEmbedReq{Model: cfg.Model, Input: texts}
+}
+
+func decodeOllamaEmbeddings(body []byte, n int) ([][]float32, error) {
+	var resp ollamaEmbedResp
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, &permanentError{fmt.Errorf("decode response: %w", err)}
+	}
+	if len(resp.Embeddings) != n {
+		return nil, &permanentError{fmt.Errorf("server returned %d embeddings for %d texts", len(resp.Embeddings), n)}
+	}
+	return resp.Embeddings, nil
+}
@@ -0,0 +1,173 @@
+package embeddings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// openAIServer answers /embeddings requests with the vector [len(text), 1]
+// for each input, listing the results in reverse order.
+func openAIServer(t *testing.T, batches *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("request to %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req openAIEmbeddingReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		*batches = append(*batches, req.Input)
+		var data []string
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, fmt.Sprintf(`{"index":%d,"embedding":[%d,1]}`, i, len(req.Input[i])))
+		}
+		fmt.Fprintf(w, `{"data":[%s]}`, strings.Join(data, ","))
+	}))
+}
+
+func TestRemoteEmbedderBatches(t *testing.T) {
+	var batches [][]string
+	srv := openAIServer(t, &batches)
+	defer srv.Close()
+
+	e := NewOpenAIEmbedder(RemoteConfig{BaseURL: srv.URL + "/v1/", APIKey: "secret", Model: "m", BatchSize: 2})
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	vecs, err := e.Embed(texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 {
+		t.Errorf("sent batches %q, want sizes 2, 2, 1", batches)
+	}
+	if e.Dimension() != 2 || e.Name() != "openai:m" {
+		t.Errorf("Dimension() = %d, Name() = %q", e.Dimension(), e.Name())
+	}
+	for i, v := range vecs {
+		// Vectors are matched to texts by index and normalized.
+		n := float64(len(texts[i]))
+		want := float32(n / math.Sqrt(n*n+1))
+		if len(v) != 2 || math.Abs(float64(v[0]-want)) > 1e-6 {
+			t.Errorf("vector %d = %v, want first component %v", i, v, want)
+		}
+	}
+}
+
+func TestOllamaEmbedder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			t.Errorf("request to %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"embeddings":[[3,4]]}`)
+	}))
+	defer srv.Close()
+
+	e := NewOllamaEmbedder(RemoteConfig{BaseURL: srv.URL, Model: "m"})
+	dim, err := e.DetectDimension(context.Background())
+	if err != nil || dim != 2 {
+		t.Fatalf("DetectDimension() = %d, %v", dim, err)
+	}
+	v, err := e.EmbedQuery("q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0] != 0.6 || v[1] != 0.8 {
+		t.Errorf("vector = %v, want [0.6 0.8]", v)
+	}
+}
+
+// flakyServer fails the first len(failures) requests with the given
+// responses and then returns a 2-dimensional embedding.
+func flakyServer(failures []func(http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := int(calls.Add(1)); n <= len(failures) {
+			failures[n-1](w)
+			return
+		}
+		fmt.Fprint(w, `{"embeddings":[[1,0]]}`)
+	}))
+	return srv, &calls
+}
+
+func status(code int, retryAfter string) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		http.Error(w, `{"error":"try later"}`, code)
+	}
+}
+
+func TestRemoteEmbedderRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   []func(http.ResponseWriter)
+		maxRetries int
+		wantCalls  int
+		wantErr    string
+		minWait    time.Duration
+	}{
+		{name: "retry after", failures: []func(http.ResponseWriter){status(429, "1")}, wantCalls: 2, minWait: time.Second},
+		{name: "backoff", failures: []func(http.ResponseWriter){status(503, ""), status(500, "")}, wantCalls: 3, minWait: 750 * time.Millisecond},
+		{name: "gives up", failures: []func(http.ResponseWriter){status(502, ""), status(502, "")}, maxRetries: 1, wantCalls: 2, wantErr: "502"},
+		{name: "no retries", failures: []func(http.ResponseWriter){status(500, "")}, maxRetries: -1, wantCalls: 1, wantErr: "500"},
+		{name: "permanent", failures: []func(http.ResponseWriter){status(401, "")}, wantCalls: 1, wantErr: "401 Unauthorized: {\"error\":\"try later\"}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := flakyServer(tt.failures)
+			defer srv.Close()
+
+			e := NewOllamaEmbedder(RemoteConfig{BaseURL: srv.URL, MaxRetries: tt.maxRetries})
+			start := time.Now()
+			_, err := e.EmbedQuery("q")
+			if elapsed := time.Since(start); elapsed < tt.minWait {
+				t.Errorf("took %v, want at least %v of waiting", elapsed, tt.minWait)
+			}
+			if n := int(calls.Load()); n != tt.wantCalls {
+				t.Errorf("sent %d requests, want %d", n, tt.wantCalls)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("err = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRemoteEmbedderStopsRetryingOnCancel(t *testing.T) {
+	srv, calls := flakyServer([]func(http.ResponseWriter){status(429, "30")})
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	e := NewOllamaEmbedder(RemoteConfig{BaseURL: srv.URL})
+	if _, err := e.EmbedQueryContext(ctx, "q"); err == nil {
+		t.Fatal("EmbedQueryContext succeeded after its context expired")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
+
+func TestRemoteEmbedderRejectsWrongDimension(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"embeddings":[[1,0,0]]}`)
+	}))
+	defer srv.Close()
+
+	e := NewOllamaEmbedder(RemoteConfig{BaseURL: srv.URL, Dim: 2})
+	if _, err := e.EmbedQuery("q"); err == nil || !strings.Contains(err.Error(), "3-dimensional") {
+		t.Errorf("err = %v, want a dimension mismatch", err)
+	}
+}
@@ -0,0 +1,225 @@
+package embeddings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Fitter is implemented by embedders that learn corpus statistics. The
+// pipeline calls Fit with a book's chunk texts before embedding them, and
+// Unfit with the same texts if the book then fails to be indexed or is
+// deleted.
+type Fitter interface {
+	Fit(texts []string) error
+	Unfit(texts []string) error
+}
+
+// TFIDFEmbedder hashes terms into a fixed-size vector like HashEmbedder but
+// weights each by sublinear term frequency (1 + ln tf) times smoothed inverse
+// document frequency. Stopwords are always dropped.
+//
+// Document frequencies accumulate with every Fit, so chunks embedded early
+// keep the weights of that time while queries use the latest ones.
+type TFIDFEmbedder struct {
+	opts HashOptions
+	path string // where Sync saves the statistics; empty for none
+
+	mu    sync.RWMutex
+	docs  int
+	df    map[string]int
+	dirty bool
+}
+
+// tfidfStats is the persisted form of the fitted statistics.
+type tfidfStats struct {
+	Analyzer  string         `json:"analyzer"`
+	Dimension int            `json:"dimension"`
+	Docs      int            `json:"docs"`
+	DF        map[string]int `json:"df"`
+}
+
+// NewTFIDFEmbedder creates an unfitted in-memory TF-IDF embedder.
+func NewTFIDFEmbedder(dim int) *TFIDFEmbedder {
+	return NewTFIDFEmbedderWithOptions(HashOptions{Dim: dim})
+}
+
+// NewTFIDFEmbedderWithOptions creates an unfitted in-memory TF-IDF embedder
+// with the given analyzer, hashing and weights. Feature weights multiply
+// the TF-IDF weight.
+func NewTFIDFEmbedderWithOptions(opts HashOptions) *TFIDFEmbedder {
+	if opts.Dim <= 0 {
+		opts.Dim = 512
+	}
+	opts.Analyzer.Stopwords = true
+	return &TFIDFEmbedder{opts: opts, df: make(map[string]int)}
+}
+
+// OpenTFIDFEmbedder loads statistics saved at path, or starts empty if the
+// file does not exist. Sync writes the statistics back to path.
+func OpenTFIDFEmbedder(path string, opts HashOptions) (*TFIDFEmbedder, error) {
+	e := NewTFIDFEmbedderWithOptions(opts)
+	e.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read tfidf stats: %w", err)
+	}
+	var st tfidfStats
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("parse tfidf stats: %w", err)
+	}
+	if st.Dimension != e.opts.Dim || st.Analyzer != e.opts.Analyzer.Name() {
+		return nil, fmt.Errorf("tfidf stats were fitted with %s/%d, want %s/%d",
+			st.Analyzer, st.Dimension, e.opts.Analyzer.Name(), e.opts.Dim)
+	}
+	e.docs = st.Docs
+	if st.DF != nil {
+		e.df = st.DF
+	}
+	return e, nil
+}
+
+// Name returns "tfidf" plus any analyzer settings beyond stopword removal
+// and any non-default hashing, e.g. "tfidf:stem/signed".
+func (e *TFIDFEmbedder) Name() string {
+	o := e.opts
+	o.Analyzer.Stopwords = false
+	return o.name("tfidf")
+}
+
+// Dimension returns the vector size.
+func (e *TFIDFEmbedder) Dimension() int { return e.opts.Dim }
+
+// Fit counts each text as one document.
+func (e *TFIDFEmbedder) Fit(texts []string) error {
+	e.count(texts, 1)
+	return nil
+}
+
+// Unfit removes the counts a Fit with the same texts added.
+func (e *TFIDFEmbedder) Unfit(texts []string) error {
+	e.count(texts, -1)
+	return nil
+}
+
+// count adds delta to the document count and to the document frequency of
+// every term of texts.
+func (e *TFIDFEmbedder) count(texts []string, delta int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, t := range texts {
+		seen := make(map[string]bool)
+		for _, tok := range e.opts.Analyzer.Analyze(t) {
+			if !seen[tok] {
+				seen[tok] = true
+				if e.df[tok] += delta; e.df[tok] <= 0 {
+					delete(e.df, tok)
+				}
+			}
+		}
+	}
+	e.docs = max(e.docs+delta*len(texts), 0)
+	e.dirty = e.dirty || len(texts) > 0
+}
+
+// Embed multiple texts.
+func (e *TFIDFEmbedder) Embed(texts []string) ([][]float32, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	result := make([][]float32, len(texts))
+	for i, t := range texts {
+		result[i] = e.embedLocked(t)
+	}
+	return result, nil
+}
+
+// EmbedQuery embeds a single query.
+func (e *TFIDFEmbedder) EmbedQuery(text string) ([]float32, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.embedLocked(text), nil
+}
+
+func (e *TFIDFEmbedder) embedLocked(text string) []float32 {
+	vec := make([]float32, e.opts.Dim)
+	tf := make(map[string]int)
+	for _, tok := range e.opts.Analyzer.Analyze(text) {
+		tf[tok]++
+	}
+	for tok, n := range tf {
+		w := (1 + math.Log(float64(n))) * e.idfLocked(tok)
+		e.opts.Hashing.add(vec, tok, float32(w)*e.opts.Weights.of(tok))
+	}
+	normalize(vec)
+	return vec
+}
+
+// idfLocked is the smoothed IDF ln((1+N)/(1+df)) + 1, which stays positive
+// for terms in every document and for unseen terms.
+func (e *TFIDFEmbedder) idfLocked(tok string) float64 {
+	return math.Log(float64(1+e.docs)/float64(1+e.df[tok])) + 1
+}
+
+// Sync saves the statistics to the path given to OpenTFIDFEmbedder if they
+// changed since the last save. It is a no-op for in-memory embedders.
+func (e *TFIDFEmbedder) Sync() error {
+	if e.path == "" {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.dirty {
+		return nil
+	}
+	if err := e.saveLocked(e.path); err != nil {
+		return err
+	}
+	e.dirty = false
+	return nil
+}
+
+// Save writes the statistics to path as JSON.
+func (e *TFIDFEmbedder) Save(path string) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.saveLocked(path)
+}
+
+// saveLocked writes to a temporary file and renames it, so a crash never
+// leaves truncated statistics.
+func (e *TFIDFEmbedder) saveLocked(path string) error {
+	data, err := json.Marshal(tfidfStats{Analyzer: e.opts.Analyzer.Name(), Dimension: e.opts.Dim, Docs: e.docs, DF: e.df})
+	if err != nil {
+		return fmt.Errorf("encode tfidf stats: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tfidf-*")
+	if err != nil {
+		return fmt.Errorf("save tfidf stats: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	// CreateTemp makes the file private; the stats are as readable as the
+	// index they sit beside.
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save tfidf stats: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save tfidf stats: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save tfidf stats: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save tfidf stats: %w", err)
+	}
+	return nil
+}
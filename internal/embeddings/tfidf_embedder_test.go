@@ -0,0 +1,40 @@
+package embeddings
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTFIDFEmbedderSavesStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tfidf.json")
+	opts := HashOptions{Dim: 64}
+	e, err := OpenTFIDFEmbedder(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Fit([]string{"the queen of hearts", "the knave of hearts"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("stats file mode = %v, want 0644", mode)
+	}
+
+	reopened, err := OpenTFIDFEmbedder(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := e.EmbedQuery("queen")
+	got, _ := reopened.EmbedQuery("queen")
+	if !slices.Equal(got, want) {
+		t.Error("reopened embedder weighs terms differently")
+	}
+}
@@ -1,13 +1,12 @@
 package eval
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
+	"sort"
+	"time"
 
-	"ragbook/internal/rag"
 	"ragbook/internal/types"
 )
 
@@ -15,31 +14,42 @@ import (
 type TestCase struct {
 	Query            string   `json:"query"`
 	ExpectedKeywords []string `json:"expected_keywords"`
+	// RelevantPassages, if present, enables the rank-aware IR metrics.
+	RelevantPassages []Passage `json:"relevant_passages,omitempty"`
 }
 
 // Result stores evaluation metrics.
 type Result struct {
 	TotalCases  int
-	AverageP    float64
-	AverageR    float64
-	AverageF1   float64
 	CaseResults []CaseResult
+
+	// Metrics lists the metric names in the order they were configured.
+	Metrics []string
+	// Averages holds each metric's mean over the cases it applied to, and
+	// Counts how many cases that was.
+	Averages map[string]float64
+	Counts   map[string]int
+}
+
+// Average returns the mean of the named metric, or 0 if it never applied.
+func (r *Result) Average(name string) float64 {
+	return r.Averages[name]
 }
 
 // CaseResult stores metrics for one test case.
 type CaseResult struct {
 	Query          string
-	Precision      float64
-	Recall         float64
-	F1Score        float64
-	MatchedCount   int
 	ExpectedCount  int
 	RetrievedCount int
 	MatchedWords   []string
+	Latency        time.Duration // query time, including embedding
+	// Scores maps metric name to value; metrics that do not apply to the
+	// case are absent.
+	Scores map[string]float64
 }
 
-// Evaluate runs all test cases and computes precision/recall/F1.
-func Evaluate(ctx context.Context, pipeline *rag.Pipeline, jsonPath string, topK int) (*Result, error) {
+// LoadCases reads evaluation cases from a JSON file.
+func LoadCases(jsonPath string) ([]TestCase, error) {
 	data, err := os.ReadFile(jsonPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read eval cases: %w", err)
@@ -49,76 +59,7 @@ func Evaluate(ctx context.Context, pipeline *rag.Pipeline, jsonPath string, topK
 	if err := json.Unmarshal(data, &cases); err != nil {
 		return nil, fmt.Errorf("failed to parse eval cases: %w", err)
 	}
-
-	results := Result{TotalCases: len(cases)}
-
-	for _, tc := range cases {
-		req := types.QueryRequest{Query: tc.Query, TopK: topK}
-		resp, err := pipeline.AnswerQuery(ctx, req)
-		if err != nil {
-			return nil, fmt.Errorf("query failed: %w", err)
-		}
-
-		retrievedText := strings.ToLower(strings.Join(extractTexts(resp.Sources), " "))
-		matchedWords := make(map[string]bool)
-
-		for _, kw := range tc.ExpectedKeywords {
-			if strings.Contains(retrievedText, strings.ToLower(kw)) {
-				matchedWords[kw] = true
-			}
-		}
-
-		matched := len(matchedWords)
-		expected := len(tc.ExpectedKeywords)
-		retrieved := len(resp.Sources)
-
-		// Avoid division by zero
-		if retrieved == 0 {
-			retrieved = 1
-		}
-		if expected == 0 {
-			expected = 1
-		}
-
-		precision := float64(matched) / float64(retrieved)
-		if precision > 1.0 {
-			precision = 1.0
-		}
-
-		recall := float64(matched) / float64(len(tc.ExpectedKeywords))
-		if recall > 1.0 {
-			recall = 1.0
-		}
-
-		f1 := 0.0
-		if precision+recall > 0 {
-			f1 = 2 * (precision * recall) / (precision + recall)
-		}
-
-		results.CaseResults = append(results.CaseResults, CaseResult{
-			Query:          tc.Query,
-			Precision:      precision,
-			Recall:         recall,
-			F1Score:        f1,
-			MatchedCount:   matched,
-			ExpectedCount:  len(tc.ExpectedKeywords),
-			RetrievedCount: len(resp.Sources),
-			MatchedWords:   mapKeys(matchedWords),
-		})
-
-		results.AverageP += precision
-		results.AverageR += recall
-		results.AverageF1 += f1
-	}
-
-	n := float64(results.TotalCases)
-	if n > 0 {
-		results.AverageP /= n
-		results.AverageR /= n
-		results.AverageF1 /= n
-	}
-
-	return &results, nil
+	return cases, nil
 }
 
 func extractTexts(srcs []types.SourceChunk) []string {
@@ -134,5 +75,6 @@ func mapKeys(m map[string]bool) []string {
 	for k := range m {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys)
 	return keys
 }
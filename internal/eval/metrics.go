@@ -0,0 +1,226 @@
+package eval
+
+import (
+	"math"
+	"strings"
+
+	"ragbook/internal/types"
+)
+
+// Metric names reported by DefaultMetrics.
+const (
+	MetricKeywordPrecision = "keyword_precision"
+	MetricKeywordRecall    = "keyword_recall"
+	MetricKeywordF1        = "keyword_f1"
+	MetricRecallAtK        = "recall_at_k"
+	MetricPrecisionAtK     = "precision_at_k"
+	MetricMRR              = "mrr"
+	MetricNDCG             = "ndcg_at_k"
+	MetricHitRate          = "hit_rate"
+	MetricRedundancy       = "redundancy"
+)
+
+// Metric scores one evaluated case. Score returns false when the metric does
+// not apply, e.g. an IR metric on a case without relevant passages; such
+// cases are left out of the metric's average.
+type Metric struct {
+	Name  string
+	Score func(c *Case) (float64, bool)
+	// LowerIsBetter marks metrics that improve as they fall, such as
+	// redundancy.
+	LowerIsBetter bool
+}
+
+// Case is what a Metric sees: the test case, the retrieved sources in rank
+// order after threshold filtering, and the expected keywords they matched.
+type Case struct {
+	TestCase
+	Sources []types.SourceChunk
+	Matched []string
+	K       int
+
+	ir *IRMetrics
+}
+
+// IR returns the case's rank-aware metrics, computed once, and false if the
+// case has no relevant passages.
+func (c *Case) IR() (IRMetrics, bool) {
+	if len(c.RelevantPassages) == 0 {
+		return IRMetrics{}, false
+	}
+	if c.ir == nil {
+		m := retrievalMetrics(c.RelevantPassages, c.Sources, c.K)
+		c.ir = &m
+	}
+	return *c.ir, true
+}
+
+// DefaultMetrics returns keyword coverage precision/recall/F1, the IR
+// metrics and redundancy.
+func DefaultMetrics() []Metric {
+	return []Metric{
+		{Name: MetricKeywordPrecision, Score: func(c *Case) (float64, bool) { p, _ := keywordPR(c); return p, true }},
+		{Name: MetricKeywordRecall, Score: func(c *Case) (float64, bool) { _, r := keywordPR(c); return r, true }},
+		{Name: MetricKeywordF1, Score: func(c *Case) (float64, bool) {
+			p, r := keywordPR(c)
+			if p+r == 0 {
+				return 0, true
+			}
+			return 2 * p * r / (p + r), true
+		}},
+		irMetric(MetricRecallAtK, func(m IRMetrics) float64 { return m.RecallAtK }),
+		irMetric(MetricPrecisionAtK, func(m IRMetrics) float64 { return m.PrecisionAtK }),
+		irMetric(MetricMRR, func(m IRMetrics) float64 { return m.MRR }),
+		irMetric(MetricNDCG, func(m IRMetrics) float64 { return m.NDCG }),
+		irMetric(MetricHitRate, func(m IRMetrics) float64 { return m.HitRate }),
+		{Name: MetricRedundancy, Score: func(c *Case) (float64, bool) { return redundancy(c.Sources), true }, LowerIsBetter: true},
+	}
+}
+
+// NeedsRelevance reports whether the named metric only scores cases with
+// relevant passages.
+func NeedsRelevance(name string) bool {
+	switch name {
+	case MetricRecallAtK, MetricPrecisionAtK, MetricMRR, MetricNDCG, MetricHitRate:
+		return true
+	}
+	return false
+}
+
+// LowerIsBetter reports whether the named default metric improves as it
+// falls. Unknown metrics are taken to be higher-is-better.
+func LowerIsBetter(name string) bool {
+	for _, m := range DefaultMetrics() {
+		if m.Name == name {
+			return m.LowerIsBetter
+		}
+	}
+	return false
+}
+
+// redundancy is the fraction of sources that overlap the text of a
+// better-ranked source of the same book; lower is better.
+func redundancy(sources []types.SourceChunk) float64 {
+	if len(sources) == 0 {
+		return 0
+	}
+	dup := 0
+	for i, s := range sources {
+		for _, prev := range sources[:i] {
+			if s.BookID == prev.BookID && s.StartOffset < prev.EndOffset && prev.StartOffset < s.EndOffset {
+				dup++
+				break
+			}
+		}
+	}
+	return float64(dup) / float64(len(sources))
+}
+
+func irMetric(name string, field func(IRMetrics) float64) Metric {
+	return Metric{Name: name, Score: func(c *Case) (float64, bool) {
+		m, ok := c.IR()
+		return field(m), ok
+	}}
+}
+
+// keywordPR is the keyword coverage score: matched keywords over retrieved
+// chunks (capped at 1) and over expected keywords.
+func keywordPR(c *Case) (precision, recall float64) {
+	matched := float64(len(c.Matched))
+	precision = min(matched/float64(max(len(c.Sources), 1)), 1)
+	recall = min(matched/float64(max(len(c.ExpectedKeywords), 1)), 1)
+	return precision, recall
+}
+
+// Passage labels a span of the book as relevant to a test case. Either Text
+// (a quotation that must appear in the chunk) or Start/End (rune offsets into
+// the book text as given, as in SourceChunk.StartOffset) identifies it. BookID, if
+// set, restricts the passage to one book.
+type Passage struct {
+	BookID string `json:"book_id,omitempty"`
+	Text   string `json:"text,omitempty"`
+	Start  int    `json:"start,omitempty"`
+	End    int    `json:"end,omitempty"`
+}
+
+// IRMetrics are rank-aware retrieval metrics for one case.
+// A chunk is relevant when it contains at least one labeled passage; each
+// passage counts once, at the rank of the first chunk containing it.
+type IRMetrics struct {
+	RecallAtK    float64 // fraction of passages found in the top k
+	PrecisionAtK float64 // fraction of the top k chunks that are relevant
+	MRR          float64 // reciprocal rank of the first relevant chunk
+	NDCG         float64 // nDCG@k with binary gains per newly found passage
+	HitRate      float64 // 1 if any relevant chunk is in the top k
+}
+
+// retrievalMetrics scores the ranked sources against the labeled passages.
+// k is the cutoff; results beyond it are ignored and a short list is not
+// padded, so missing results count as non-relevant.
+func retrievalMetrics(passages []Passage, sources []types.SourceChunk, k int) IRMetrics {
+	var m IRMetrics
+	if len(passages) == 0 || k <= 0 {
+		return m
+	}
+	if len(sources) > k {
+		sources = sources[:k]
+	}
+
+	found := make([]bool, len(passages))
+	var relevant, nFound int
+	var dcg float64
+	for rank, s := range sources {
+		text := normalizeText(s.Text)
+		hit := false
+		for i, p := range passages {
+			if !p.matches(s, text) {
+				continue
+			}
+			hit = true
+			if !found[i] {
+				found[i] = true
+				nFound++
+				dcg += 1 / math.Log2(float64(rank+2))
+			}
+		}
+		if hit {
+			relevant++
+			if m.MRR == 0 {
+				m.MRR = 1 / float64(rank+1)
+			}
+		}
+	}
+
+	var idcg float64
+	for i := 0; i < min(k, len(passages)); i++ {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+
+	m.RecallAtK = float64(nFound) / float64(len(passages))
+	m.PrecisionAtK = float64(relevant) / float64(k)
+	m.NDCG = dcg / idcg
+	if relevant > 0 {
+		m.HitRate = 1
+	}
+	return m
+}
+
+// matches reports whether the chunk contains the passage. normText is the
+// chunk text after normalizeText.
+func (p Passage) matches(s types.SourceChunk, normText string) bool {
+	if p.BookID != "" && p.BookID != s.BookID {
+		return false
+	}
+	if p.Text != "" {
+		return strings.Contains(normText, normalizeText(p.Text))
+	}
+	return p.End > p.Start && s.StartOffset <= p.Start && p.End <= s.EndOffset
+}
+
+var quoteReplacer = strings.NewReplacer("’", "'", "‘", "'", "“", `"`, "”", `"`)
+
+// normalizeText lowercases, straightens curly quotes and collapses
+// whitespace so quotations match regardless of line wrapping.
+func normalizeText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(quoteReplacer.Replace(s))), " ")
+}
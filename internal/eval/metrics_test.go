@@ -0,0 +1,42 @@
+package eval
+
+import (
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+func TestRedundancy(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []types.SourceChunk
+		want    float64
+	}{
+		{"none", nil, 0},
+		{
+			name: "disjoint and adjacent",
+			sources: []types.SourceChunk{
+				{BookID: "alice", StartOffset: 0, EndOffset: 10},
+				{BookID: "alice", StartOffset: 10, EndOffset: 20},
+				{BookID: "bob", StartOffset: 0, EndOffset: 10},
+			},
+			want: 0,
+		},
+		{
+			// b overlaps a and d overlaps b; c is another book.
+			name: "overlapping",
+			sources: []types.SourceChunk{
+				{BookID: "alice", StartOffset: 0, EndOffset: 10},
+				{BookID: "alice", StartOffset: 5, EndOffset: 15},
+				{BookID: "bob", StartOffset: 5, EndOffset: 15},
+				{BookID: "alice", StartOffset: 10, EndOffset: 20},
+			},
+			want: 0.5,
+		},
+	}
+	for _, tt := range tests {
+		if got := redundancy(tt.sources); got != tt.want {
+			t.Errorf("%s: redundancy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
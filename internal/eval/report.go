@@ -0,0 +1,264 @@
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Report is the machine-readable record of one evaluation run.
+type Report struct {
+	CreatedAt time.Time          `json:"created_at"`
+	Config    map[string]string  `json:"config"`
+	Metrics   []string           `json:"metrics"`
+	Averages  map[string]float64 `json:"averages"`
+	Timings   Timings            `json:"timings"`
+	Cases     []CaseReport       `json:"cases"`
+}
+
+// Timings records wall-clock durations in milliseconds.
+type Timings struct {
+	IngestMS float64 `json:"ingest_ms"`
+	EvalMS   float64 `json:"eval_ms"`
+}
+
+// CaseReport is one case of a Report.
+type CaseReport struct {
+	Query        string             `json:"query"`
+	Retrieved    int                `json:"retrieved"`
+	MatchedWords []string           `json:"matched_words"`
+	Scores       map[string]float64 `json:"scores"`
+	LatencyMS    float64            `json:"latency_ms"`
+}
+
+// NewReport builds a report from a result. config describes the run, e.g.
+// chunking and retrieval settings.
+func NewReport(result *Result, config map[string]string, ingest, evalTime time.Duration) *Report {
+	r := &Report{
+		CreatedAt: time.Now().UTC(),
+		Config:    config,
+		Metrics:   result.Metrics,
+		Averages:  result.Averages,
+		Timings:   Timings{IngestMS: ms(ingest), EvalMS: ms(evalTime)},
+	}
+	for _, c := range result.CaseResults {
+		r.Cases = append(r.Cases, CaseReport{
+			Query:        c.Query,
+			Retrieved:    c.RetrievedCount,
+			MatchedWords: c.MatchedWords,
+			Scores:       c.Scores,
+			LatencyMS:    ms(c.Latency),
+		})
+	}
+	return r
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// LoadReport reads a JSON report written by WriteJSON.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse report: %w", err)
+	}
+	return &r, nil
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes one row per case followed by an "AVERAGE" row. Metrics
+// that do not apply to a case are left empty.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := append([]string{"query", "retrieved", "latency_ms"}, r.Metrics...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, c := range r.Cases {
+		row := []string{c.Query, strconv.Itoa(c.Retrieved), formatFloat(c.LatencyMS)}
+		for _, m := range r.Metrics {
+			row = append(row, scoreCell(c.Scores, m))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	avg := []string{"AVERAGE", "", ""}
+	for _, m := range r.Metrics {
+		avg = append(avg, scoreCell(r.Averages, m))
+	}
+	if err := cw.Write(avg); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes the config, averages and per-case scores as tables.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Evaluation report\n\n%s · ingest %.0f ms · eval %.0f ms\n\n",
+		r.CreatedAt.Format(time.RFC3339), r.Timings.IngestMS, r.Timings.EvalMS)
+
+	b.WriteString("## Config\n\n| Setting | Value |\n|:--|:--|\n")
+	for _, k := range sortedKeys(r.Config) {
+		fmt.Fprintf(&b, "| %s | %s |\n", k, mdEscape(r.Config[k]))
+	}
+
+	b.WriteString("\n## Averages\n\n| Metric | Value |\n|:--|--:|\n")
+	for _, m := range r.Metrics {
+		fmt.Fprintf(&b, "| %s | %s |\n", m, scoreCell(r.Averages, m))
+	}
+
+	b.WriteString("\n## Cases\n\n| Query |")
+	for _, m := range r.Metrics {
+		fmt.Fprintf(&b, " %s |", m)
+	}
+	b.WriteString(" latency_ms |\n|:--|")
+	b.WriteString(strings.Repeat("--:|", len(r.Metrics)+1))
+	b.WriteString("\n")
+	for _, c := range r.Cases {
+		fmt.Fprintf(&b, "| %s |", mdEscape(c.Query))
+		for _, m := range r.Metrics {
+			fmt.Fprintf(&b, " %s |", scoreCell(c.Scores, m))
+		}
+		fmt.Fprintf(&b, " %s |\n", formatFloat(c.LatencyMS))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Delta is the change of one metric between a baseline and the current run.
+type Delta struct {
+	Metric   string
+	Baseline float64
+	Current  float64
+	Delta    float64
+}
+
+// CaseDelta holds the metric deltas of a case present in both runs.
+type CaseDelta struct {
+	Query  string
+	Deltas []Delta
+}
+
+// Worsening is how much worse the current value is than the baseline, taking
+// the metric's direction into account; negative values are improvements.
+func (d Delta) Worsening() float64 {
+	if LowerIsBetter(d.Metric) {
+		return d.Delta
+	}
+	return -d.Delta
+}
+
+// Comparison is the outcome of Compare.
+type Comparison struct {
+	Averages    []Delta
+	Cases       []CaseDelta
+	Regressions []Delta  // checked averages that worsened by more than the tolerance
+	Missing     []string // checked metrics without an average in one of the runs
+}
+
+// Failed reports whether a checked metric regressed or could not be checked.
+func (c *Comparison) Failed() bool {
+	return len(c.Regressions) > 0 || len(c.Missing) > 0
+}
+
+// Compare diffs current against baseline. Cases are paired by query and
+// metrics by name; unchecked metrics and cases missing from either run are
+// skipped. An average of a checked metric that worsens by more than
+// tolerance is a regression; a checked metric missing from either run is
+// reported in Missing.
+func Compare(baseline, current *Report, checked []string, tolerance float64) *Comparison {
+	cmp := &Comparison{}
+	for _, m := range current.Metrics {
+		d, ok := delta(m, baseline.Averages, current.Averages)
+		if !ok {
+			continue
+		}
+		cmp.Averages = append(cmp.Averages, d)
+	}
+	for _, m := range checked {
+		d, ok := delta(m, baseline.Averages, current.Averages)
+		switch {
+		case !ok:
+			cmp.Missing = append(cmp.Missing, m)
+		case d.Worsening() > tolerance:
+			cmp.Regressions = append(cmp.Regressions, d)
+		}
+	}
+
+	base := make(map[string]CaseReport, len(baseline.Cases))
+	for _, c := range baseline.Cases {
+		base[c.Query] = c
+	}
+	for _, c := range current.Cases {
+		b, ok := base[c.Query]
+		if !ok {
+			continue
+		}
+		cd := CaseDelta{Query: c.Query}
+		for _, m := range current.Metrics {
+			if d, ok := delta(m, b.Scores, c.Scores); ok {
+				cd.Deltas = append(cd.Deltas, d)
+			}
+		}
+		cmp.Cases = append(cmp.Cases, cd)
+	}
+	return cmp
+}
+
+func delta(metric string, baseline, current map[string]float64) (Delta, bool) {
+	b, okB := baseline[metric]
+	c, okC := current[metric]
+	if !okB || !okC {
+		return Delta{}, false
+	}
+	return Delta{Metric: metric, Baseline: b, Current: c, Delta: c - b}, true
+}
+
+func scoreCell(scores map[string]float64, metric string) string {
+	v, ok := scores[metric]
+	if !ok {
+		return ""
+	}
+	return formatFloat(v)
+}
+
+func formatFloat(v float64) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
+
+func mdEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
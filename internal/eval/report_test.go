@@ -0,0 +1,33 @@
+package eval
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	baseline := &Report{
+		Metrics:  []string{MetricKeywordF1, MetricMRR, MetricRedundancy},
+		Averages: map[string]float64{MetricKeywordF1: 0.8, MetricRedundancy: 0.1},
+	}
+	current := &Report{
+		Metrics:  []string{MetricKeywordF1, MetricMRR, MetricRedundancy},
+		Averages: map[string]float64{MetricKeywordF1: 0.85, MetricMRR: 0.5, MetricRedundancy: 0.3},
+	}
+
+	cmp := Compare(baseline, current, []string{MetricKeywordF1, MetricRedundancy}, 0.05)
+	if len(cmp.Regressions) != 1 || cmp.Regressions[0].Metric != MetricRedundancy {
+		t.Errorf("regressions = %+v, want only the rise in redundancy", cmp.Regressions)
+	}
+	if len(cmp.Missing) != 0 || !cmp.Failed() {
+		t.Errorf("missing = %v, failed = %v", cmp.Missing, cmp.Failed())
+	}
+
+	// A better keyword_f1 and a lower redundancy are both improvements.
+	cmp = Compare(current, baseline, []string{MetricKeywordF1, MetricRedundancy}, 0.1)
+	if len(cmp.Regressions) != 0 {
+		t.Errorf("regressions = %+v, want none within tolerance", cmp.Regressions)
+	}
+
+	cmp = Compare(baseline, current, []string{MetricMRR}, 0.05)
+	if len(cmp.Missing) != 1 || cmp.Missing[0] != MetricMRR || !cmp.Failed() {
+		t.Errorf("missing = %v, want mrr, which the baseline lacks", cmp.Missing)
+	}
+}
@@ -0,0 +1,208 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"ragbook/internal/analysis"
+	"ragbook/internal/parallel"
+	"ragbook/internal/rag"
+	"ragbook/internal/types"
+)
+
+// KeywordMatcher reports whether an expected keyword occurs in the
+// retrieved text.
+type KeywordMatcher func(text, keyword string) bool
+
+// SubstringMatcher matches keywords case-insensitively anywhere in the text.
+func SubstringMatcher(text, keyword string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(keyword))
+}
+
+// WordMatcher matches keywords case-insensitively on word boundaries, so
+// "mad" does not match "made".
+func WordMatcher(text, keyword string) bool {
+	re, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(keyword) + `\b`)
+	return err == nil && re.MatchString(text)
+}
+
+// StemMatcher matches keywords whose Porter-stemmed words appear
+// consecutively in the stemmed text, so "execution" matches "executions".
+func StemMatcher(text, keyword string) bool {
+	kw := stemAll(analysis.Tokenize(keyword))
+	if len(kw) == 0 {
+		return false
+	}
+	words := stemAll(analysis.Tokenize(text))
+	for i := 0; i+len(kw) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(kw)], kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func stemAll(words []string) []string {
+	for i, w := range words {
+		words[i] = analysis.Stem(w)
+	}
+	return words
+}
+
+// ParseMatcher resolves a matcher name: "substring" (the default), "word" or
+// "stem".
+func ParseMatcher(name string) (KeywordMatcher, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "substring":
+		return SubstringMatcher, nil
+	case "word":
+		return WordMatcher, nil
+	case "stem":
+		return StemMatcher, nil
+	default:
+		return nil, fmt.Errorf("unknown keyword matcher %q", name)
+	}
+}
+
+// Options configures a Runner. Zero values select the defaults.
+type Options struct {
+	TopK int // chunks retrieved per query; default 3
+	// Threshold is sent as the request's MinScore, so the pipeline drops
+	// chunks whose vector similarity is below it; the scale depends on the
+	// similarity metric. Nil means no threshold.
+	Threshold     *float32
+	RetrievalMode string   // see rag.ParseRetrievalMode
+	Diversity     string   // see rag.ParseDiversity
+	MMRLambda     *float32 // relevance weight for "mmr"; nil means rag.DefaultMMRLambda
+	Expand        int      // neighbor chunks added on each side of a hit; see types.QueryRequest
+	Rerank        string   // see rag.ParseRerank
+	RerankDepth   int      // candidates retrieved for reranking; 0 means rag.DefaultRerankDepth
+	Matcher       KeywordMatcher
+	Concurrency   int      // queries in flight; default 1
+	Metrics       []Metric // default DefaultMetrics()
+}
+
+// Runner evaluates test cases against a pipeline.
+type Runner struct {
+	pipeline *rag.Pipeline
+	opts     Options
+}
+
+// NewRunner returns a Runner with defaults filled in for unset options.
+func NewRunner(pipeline *rag.Pipeline, opts Options) (*Runner, error) {
+	if _, err := rag.ParseRetrievalMode(opts.RetrievalMode); err != nil {
+		return nil, err
+	}
+	if _, err := rag.ParseDiversity(opts.Diversity); err != nil {
+		return nil, err
+	}
+	if _, err := rag.ParseRerank(opts.Rerank); err != nil {
+		return nil, err
+	}
+	if opts.TopK <= 0 {
+		opts.TopK = 3
+	}
+	if opts.Matcher == nil {
+		opts.Matcher = SubstringMatcher
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = DefaultMetrics()
+	}
+	return &Runner{pipeline: pipeline, opts: opts}, nil
+}
+
+// RunFile loads cases from jsonPath and runs them.
+func (r *Runner) RunFile(ctx context.Context, jsonPath string) (*Result, error) {
+	cases, err := LoadCases(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	return r.Run(ctx, cases)
+}
+
+// Run queries every case, scores it with each metric and averages the
+// scores. Case results keep the input order regardless of concurrency.
+func (r *Runner) Run(ctx context.Context, cases []TestCase) (*Result, error) {
+	caseResults, err := parallel.Map(ctx, len(cases), r.opts.Concurrency, func(ctx context.Context, i int) (CaseResult, error) {
+		return r.runCase(ctx, cases[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		TotalCases:  len(cases),
+		CaseResults: caseResults,
+		Averages:    make(map[string]float64, len(r.opts.Metrics)),
+		Counts:      make(map[string]int, len(r.opts.Metrics)),
+	}
+	for _, m := range r.opts.Metrics {
+		result.Metrics = append(result.Metrics, m.Name)
+		for _, c := range caseResults {
+			if v, ok := c.Scores[m.Name]; ok {
+				result.Averages[m.Name] += v
+				result.Counts[m.Name]++
+			}
+		}
+		if n := result.Counts[m.Name]; n > 0 {
+			result.Averages[m.Name] /= float64(n)
+		}
+	}
+	return result, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, tc TestCase) (CaseResult, error) {
+	topK, expand := r.opts.TopK, r.opts.Expand
+	req := types.QueryRequest{
+		Query:         tc.Query,
+		TopK:          &topK,
+		RetrievalMode: r.opts.RetrievalMode,
+		MinScore:      r.opts.Threshold,
+		Diversity:     r.opts.Diversity,
+		MMRLambda:     r.opts.MMRLambda,
+		Expand:        &expand,
+		Rerank:        r.opts.Rerank,
+	}
+	if r.opts.RerankDepth > 0 {
+		depth := r.opts.RerankDepth
+		req.RerankDepth = &depth
+	}
+	start := time.Now()
+	resp, err := r.pipeline.AnswerQuery(ctx, req)
+	latency := time.Since(start)
+	if err != nil {
+		return CaseResult{}, fmt.Errorf("query %q failed: %w", tc.Query, err)
+	}
+
+	sources := resp.Sources
+	retrievedText := strings.Join(extractTexts(sources), " ")
+	matchedWords := make(map[string]bool)
+	for _, kw := range tc.ExpectedKeywords {
+		if r.opts.Matcher(retrievedText, kw) {
+			matchedWords[kw] = true
+		}
+	}
+
+	c := &Case{TestCase: tc, Sources: sources, Matched: mapKeys(matchedWords), K: r.opts.TopK}
+	scores := make(map[string]float64, len(r.opts.Metrics))
+	for _, m := range r.opts.Metrics {
+		if v, ok := m.Score(c); ok {
+			scores[m.Name] = v
+		}
+	}
+	return CaseResult{
+		Query:          tc.Query,
+		ExpectedCount:  len(tc.ExpectedKeywords),
+		RetrievedCount: len(sources),
+		MatchedWords:   c.Matched,
+		Latency:        latency,
+		Scores:         scores,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package eval
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"ragbook/internal/embeddings"
+	"ragbook/internal/rag"
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+const runnerBook = "Alice was beginning to get very tired of sitting by her sister on the bank.\n\n" +
+	"Suddenly a White Rabbit with pink eyes ran close by her, muttering about being late.\n\n" +
+	"The Queen of Hearts, she made some tarts, all on a summer day.\n\n" +
+	"The Knave of Hearts, he stole those tarts, and took them clean away.\n\n" +
+	"The Hatter and the March Hare were having tea at a table under a tree."
+
+var runnerCases = []TestCase{
+	{Query: "who stole the tarts", ExpectedKeywords: []string{"Knave", "tarts", "summer"},
+		RelevantPassages: []Passage{{Text: "he stole those tarts"}}},
+	{Query: "the white rabbit", ExpectedKeywords: []string{"rabbit", "pink eyes", "watch"}},
+	{Query: "tea party", ExpectedKeywords: []string{"Hatter", "March Hare"},
+		RelevantPassages: []Passage{{Text: "having tea"}, {Text: "sitting by her sister"}}},
+}
+
+// legacyScores scores one case the way Evaluate did before the Runner
+// replaced it: substring keyword coverage plus the IR metrics at topK.
+func legacyScores(tc TestCase, sources []types.SourceChunk, topK int) map[string]float64 {
+	text := strings.ToLower(strings.Join(extractTexts(sources), " "))
+	matched := 0
+	for _, kw := range tc.ExpectedKeywords {
+		if strings.Contains(text, strings.ToLower(kw)) {
+			matched++
+		}
+	}
+	precision := min(float64(matched)/float64(max(len(sources), 1)), 1)
+	recall := min(float64(matched)/float64(len(tc.ExpectedKeywords)), 1)
+	f1 := 0.0
+	if precision+recall > 0 {
+		f1 = 2 * precision * recall / (precision + recall)
+	}
+	scores := map[string]float64{
+		MetricKeywordPrecision: precision,
+		MetricKeywordRecall:    recall,
+		MetricKeywordF1:        f1,
+	}
+	if len(tc.RelevantPassages) > 0 {
+		ir := retrievalMetrics(tc.RelevantPassages, sources, topK)
+		scores[MetricRecallAtK] = ir.RecallAtK
+		scores[MetricPrecisionAtK] = ir.PrecisionAtK
+		scores[MetricMRR] = ir.MRR
+		scores[MetricNDCG] = ir.NDCG
+		scores[MetricHitRate] = ir.HitRate
+	}
+	return scores
+}
+
+func TestRunnerMatchesLegacyEvaluate(t *testing.T) {
+	ctx := context.Background()
+	p := rag.NewPipeline(store.NewMemoryStore(), embeddings.NewHashEmbedder(64))
+	if _, err := p.IngestBook(ctx, "alice", runnerBook, rag.IngestConfig{ChunkSize: 80, Chunker: rag.ChunkStructured}); err != nil {
+		t.Fatal(err)
+	}
+	const topK = 3
+	r, err := NewRunner(p, Options{TopK: topK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := r.Run(ctx, runnerCases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalCases != len(runnerCases) || len(result.CaseResults) != len(runnerCases) {
+		t.Fatalf("got %d results for %d cases", len(result.CaseResults), len(runnerCases))
+	}
+
+	sums, counts := map[string]float64{}, map[string]int{}
+	for i, tc := range runnerCases {
+		k := topK
+		resp, err := p.AnswerQuery(ctx, types.QueryRequest{Query: tc.Query, TopK: &k})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := legacyScores(tc, resp.Sources, topK)
+		got := result.CaseResults[i]
+		if got.Query != tc.Query || got.RetrievedCount != len(resp.Sources) || got.ExpectedCount != len(tc.ExpectedKeywords) {
+			t.Errorf("case %d = %q with %d retrieved and %d expected", i, got.Query, got.RetrievedCount, got.ExpectedCount)
+		}
+		for name, v := range want {
+			if g, ok := got.Scores[name]; !ok || math.Abs(g-v) > 1e-12 {
+				t.Errorf("case %q: %s = %v (present %v), want %v", tc.Query, name, g, ok, v)
+			}
+			sums[name] += v
+			counts[name]++
+		}
+		if _, ok := got.Scores[MetricMRR]; ok != (len(tc.RelevantPassages) > 0) {
+			t.Errorf("case %q: IR metrics present = %v", tc.Query, ok)
+		}
+	}
+	for name, sum := range sums {
+		if result.Counts[name] != counts[name] || math.Abs(result.Averages[name]-sum/float64(counts[name])) > 1e-12 {
+			t.Errorf("%s: average %v over %d cases, want %v over %d",
+				name, result.Averages[name], result.Counts[name], sum/float64(counts[name]), counts[name])
+		}
+	}
+	// Evaluate averaged keyword scores over every case and IR metrics over
+	// the labeled ones.
+	if counts[MetricKeywordF1] != 3 || counts[MetricMRR] != 2 {
+		t.Errorf("counts = %v", counts)
+	}
+}
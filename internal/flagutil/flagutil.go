@@ -0,0 +1,25 @@
+// Package flagutil parses list-valued command-line flags.
+package flagutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PositiveInts parses a comma-separated list of positive integers, such as
+// "16,32,64".
+func PositiveInts(s string) ([]int, error) {
+	var out []int
+	for _, f := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("%d is not positive", n)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
@@ -0,0 +1,102 @@
+// Package httpclient holds the JSON-over-HTTP plumbing shared by the remote
+// embedders, generators and rerankers.
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Default API roots of the supported model servers. Any server implementing
+// the OpenAI API can be used instead of OpenAI itself.
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	DefaultOllamaBaseURL = "http://localhost:11434"
+)
+
+// maxErrorBody bounds how much of an error response is quoted in errors.
+const maxErrorBody = 512
+
+// StatusError is a non-2xx response.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       string // start of the response body
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.URL, e.Status, e.Body)
+}
+
+// BearerHeader returns a header authorizing with apiKey, or an empty header
+// if apiKey is empty.
+func BearerHeader(apiKey string) http.Header {
+	h := http.Header{}
+	if apiKey != "" {
+		h.Set("Authorization", "Bearer "+apiKey)
+	}
+	return h
+}
+
+// Post sends body as a JSON POST to url and returns the response body, which
+// the caller must close. A nil client means http.DefaultClient. Non-2xx
+// responses are returned as a *StatusError.
+func Post(ctx context.Context, client *http.Client, url string, header http.Header, body []byte) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, &StatusError{
+			URL:        url,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header,
+			Body:       strings.TrimSpace(string(msg)),
+		}
+	}
+	return resp.Body, nil
+}
+
+// PostStream is Post for a request encoded from in.
+func PostStream(ctx context.Context, client *http.Client, url string, header http.Header, in any) (io.ReadCloser, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	return Post(ctx, client, url, header, body)
+}
+
+// PostJSON is PostStream decoding a JSON response into out.
+func PostJSON(ctx context.Context, client *http.Client, url string, header http.Header, in, out any) error {
+	body, err := PostStream(ctx, client, url, header, in)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package keyword
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"ragbook/internal/analysis"
+	"ragbook/internal/types"
+)
+
+// Okapi BM25 parameters.
+const (
+	DefaultK1 = 1.2
+	DefaultB  = 0.75
+)
+
+// Index is an in-memory BM25 inverted index over document chunks.
+type Index struct {
+	mu       sync.RWMutex
+	k1, b    float64
+	analyzer analysis.Analyzer
+	docs     []doc
+	postings map[string][]posting
+	totalLen int
+}
+
+type doc struct {
+	chunk  types.DocumentChunk // without embedding
+	length int
+}
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// NewIndex creates an empty index with the default BM25 parameters that only
+// tokenizes text.
+func NewIndex() *Index {
+	return NewIndexWithAnalyzer(analysis.Analyzer{})
+}
+
+// NewIndexWithAnalyzer creates an empty index that analyzes chunks and
+// queries with a.
+func NewIndexWithAnalyzer(a analysis.Analyzer) *Index {
+	return &Index{k1: DefaultK1, b: DefaultB, analyzer: a, postings: make(map[string][]posting)}
+}
+
+// Analyzer returns the index's analyzer.
+func (ix *Index) Analyzer() analysis.Analyzer {
+	return ix.analyzer
+}
+
+// Add indexes a chunk's text.
+func (ix *Index) Add(chunk types.DocumentChunk) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.addLocked(chunk)
+}
+
+func (ix *Index) addLocked(chunk types.DocumentChunk) {
+	chunk.Embedding = nil
+	tokens := ix.analyzer.Analyze(chunk.Text)
+	tf := make(map[string]int, len(tokens))
+	for _, t := range tokens {
+		tf[t]++
+	}
+
+	id := len(ix.docs)
+	ix.docs = append(ix.docs, doc{chunk: chunk, length: len(tokens)})
+	ix.totalLen += len(tokens)
+	for term, n := range tf {
+		ix.postings[term] = append(ix.postings[term], posting{doc: id, tf: n})
+	}
+}
+
+// DeleteBook removes every chunk of a book and returns how many were removed.
+// The postings are rebuilt from the remaining chunks.
+func (ix *Index) DeleteBook(bookID string) int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	old := ix.docs
+	ix.docs = nil
+	ix.postings = make(map[string][]posting)
+	ix.totalLen = 0
+	for _, d := range old {
+		if d.chunk.BookID != bookID {
+			ix.addLocked(d.chunk)
+		}
+	}
+	return len(old) - len(ix.docs)
+}
+
+// Count returns the number of indexed chunks.
+func (ix *Index) Count() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+// Search returns the topK chunks passing filter with the highest BM25 score
+// for query. Chunks that share no term with the query are not returned.
+func (ix *Index) Search(query string, topK int, filter *types.SearchFilter) []types.SourceChunk {
+	if topK <= 0 {
+		topK = 5
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	n := len(ix.docs)
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(ix.totalLen) / float64(n)
+
+	scores := make(map[int]float64)
+	seen := make(map[string]bool)
+	for _, term := range ix.analyzer.Analyze(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		plist := ix.postings[term]
+		if len(plist) == 0 {
+			continue
+		}
+		idf := idf(n, len(plist))
+		for _, p := range plist {
+			if !filter.Match(&ix.docs[p.doc].chunk) {
+				continue
+			}
+			scores[p.doc] += idf * ix.tfWeight(p.tf, ix.docs[p.doc].length, avgLen)
+		}
+	}
+
+	ids := make([]int, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > topK {
+		ids = ids[:topK]
+	}
+
+	results := make([]types.SourceChunk, len(ids))
+	for i, id := range ids {
+		results[i] = ix.docs[id].chunk.Source(float32(scores[id]))
+	}
+	return results
+}
+
+// Score returns the BM25 score of each text for query. Term statistics come
+// from the indexed chunks, so the texts are scored as if they were part of
+// the corpus without having to be indexed.
+func (ix *Index) Score(query string, texts []string) []float64 {
+	scores := make([]float64, len(texts))
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	n := len(ix.docs)
+	if n == 0 {
+		return scores
+	}
+	avgLen := float64(ix.totalLen) / float64(n)
+
+	idfs := make(map[string]float64)
+	for _, term := range ix.analyzer.Analyze(query) {
+		if df := len(ix.postings[term]); df > 0 {
+			idfs[term] = idf(n, df)
+		}
+	}
+	if len(idfs) == 0 {
+		return scores
+	}
+	for i, text := range texts {
+		tokens := ix.analyzer.Analyze(text)
+		tf := make(map[string]int, len(idfs))
+		for _, t := range tokens {
+			if _, ok := idfs[t]; ok {
+				tf[t]++
+			}
+		}
+		for term, n := range tf {
+			scores[i] += idfs[term] * ix.tfWeight(n, len(tokens), avgLen)
+		}
+	}
+	return scores
+}
+
+// idf is the BM25 inverse document frequency of a term occurring in df of
+// n documents.
+func idf(n, df int) float64 {
+	return math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// tfWeight is the saturated, length-normalized weight of a term occurring
+// tf times in a document of the given length.
+func (ix *Index) tfWeight(tf, length int, avgLen float64) float64 {
+	f := float64(tf)
+	norm := 1 - ix.b + ix.b*float64(length)/avgLen
+	return f * (ix.k1 + 1) / (f + ix.k1*norm)
+}
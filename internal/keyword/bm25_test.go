@@ -0,0 +1,78 @@
+package keyword
+
+import (
+	"math"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+func testIndex() *Index {
+	ix := NewIndex()
+	for i, text := range []string{
+		"The Queen shouted off with her head",
+		"The Queen of Hearts she made some tarts",
+		"The cook threw pepper at the Queen",
+		"Queen",
+	} {
+		book := "alice"
+		if i == 3 {
+			book = "bob"
+		}
+		ix.Add(types.DocumentChunk{ID: string(rune('a' + i)), BookID: book, Index: i, Text: text})
+	}
+	return ix
+}
+
+func ids(sources []types.SourceChunk) string {
+	var s string
+	for _, src := range sources {
+		s += src.ID
+	}
+	return s
+}
+
+func TestBM25Ranking(t *testing.T) {
+	ix := testIndex()
+	tests := []struct {
+		query  string
+		filter *types.SearchFilter
+		want   string
+	}{
+		// A rare term outweighs a common one, and chunks without any
+		// query term are left out.
+		{"pepper tarts", nil, "cb"},
+		// Shorter chunks rank higher for the same term frequency.
+		{"queen", nil, "dacb"},
+		{"queen", &types.SearchFilter{BookIDs: []string{"alice"}}, "acb"},
+		{"dormouse", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := ids(ix.Search(tt.query, 10, tt.filter)); got != tt.want {
+			t.Errorf("Search(%q, %+v) = %q, want %q", tt.query, tt.filter, got, tt.want)
+		}
+	}
+
+	// "queen" occurs in all 4 chunks, whose average length is 5.75 tokens;
+	// "Queen" is 1 token long.
+	idf := math.Log(1 + 0.5/4.5)
+	norm := 1 - DefaultB + DefaultB*1/5.75
+	want := idf * (DefaultK1 + 1) / (1 + DefaultK1*norm)
+	got := ix.Search("queen", 1, nil)
+	if len(got) != 1 || math.Abs(float64(got[0].Score)-want) > 1e-6 {
+		t.Errorf("top score = %+v, want %v", got, want)
+	}
+	if scores := ix.Score("queen", []string{"Queen"}); math.Abs(scores[0]-want) > 1e-9 {
+		t.Errorf("Score = %v, want %v", scores[0], want)
+	}
+}
+
+func TestBM25DeleteBook(t *testing.T) {
+	ix := testIndex()
+	if n := ix.DeleteBook("bob"); n != 1 || ix.Count() != 3 {
+		t.Fatalf("DeleteBook removed %d chunks, %d left", n, ix.Count())
+	}
+	if got := ids(ix.Search("queen", 10, nil)); got != "acb" {
+		t.Errorf("Search after delete = %q, want acb", got)
+	}
+}
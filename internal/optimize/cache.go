@@ -0,0 +1,117 @@
+package optimize
+
+import (
+	"context"
+	"sync"
+
+	"ragbook/internal/rag"
+)
+
+// IngestKey holds the parameters that determine a built index. Trials that
+// differ only in query-time parameters share one index.
+type IngestKey struct {
+	ChunkSize    int
+	ChunkOverlap int
+	Dim          int
+}
+
+// IngestKey returns the ingestion part of p.
+func (p Params) IngestKey() IngestKey {
+	return IngestKey{ChunkSize: p.ChunkSize, ChunkOverlap: p.ChunkOverlap, Dim: p.Dim}
+}
+
+// IndexCache builds each index once and hands the same pipeline to every
+// trial that needs it. Concurrent requests for an index being built wait
+// for it; a failed build is not cached. When more than capacity indexes are
+// cached the least recently used finished one is dropped, so a later trial
+// needing it rebuilds it.
+type IndexCache struct {
+	build    func(ctx context.Context, key IngestKey) (*rag.Pipeline, error)
+	capacity int
+
+	mu      sync.Mutex
+	entries map[IngestKey]*cacheEntry
+	clock   int
+	builds  int
+}
+
+type cacheEntry struct {
+	done     chan struct{}
+	pipeline *rag.Pipeline
+	err      error
+	lastUsed int
+}
+
+// NewIndexCache returns a cache that calls build on a miss and holds at
+// most capacity indexes; capacity <= 0 means unbounded.
+func NewIndexCache(capacity int, build func(ctx context.Context, key IngestKey) (*rag.Pipeline, error)) *IndexCache {
+	return &IndexCache{build: build, capacity: capacity, entries: make(map[IngestKey]*cacheEntry)}
+}
+
+// Get returns the pipeline for key, building it if needed.
+func (c *IndexCache) Get(ctx context.Context, key IngestKey) (*rag.Pipeline, error) {
+	c.mu.Lock()
+	c.clock++
+	e, ok := c.entries[key]
+	if !ok {
+		e = &cacheEntry{done: make(chan struct{})}
+		c.entries[key] = e
+		c.builds++
+		c.evictLocked()
+	}
+	e.lastUsed = c.clock
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case <-e.done:
+			if e.err != nil {
+				return nil, e.err
+			}
+			return e.pipeline, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	e.pipeline, e.err = c.build(ctx, key)
+	if e.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	close(e.done)
+	return e.pipeline, e.err
+}
+
+// evictLocked drops least recently used finished entries until the cache is
+// within capacity. Entries still being built are kept.
+func (c *IndexCache) evictLocked() {
+	for c.capacity > 0 && len(c.entries) > c.capacity {
+		var victim IngestKey
+		oldest := -1
+		for k, e := range c.entries {
+			select {
+			case <-e.done:
+			default:
+				continue
+			}
+			if oldest < 0 || e.lastUsed < oldest {
+				victim, oldest = k, e.lastUsed
+			}
+		}
+		if oldest < 0 {
+			return
+		}
+		delete(c.entries, victim)
+	}
+}
+
+// Builds returns how many indexes have been built, including failed builds.
+func (c *IndexCache) Builds() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.builds
+}
@@ -0,0 +1,86 @@
+package optimize
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"ragbook/internal/eval"
+)
+
+// Config is the optimizer's JSON configuration file.
+type Config struct {
+	Book        string      `json:"book"`
+	Eval        string      `json:"eval"`
+	Strategy    string      `json:"strategy"`  // grid, random or halving
+	Objective   string      `json:"objective"` // eval metric name to maximize; see Validate
+	Samples     int         `json:"samples"`   // candidates for random and halving
+	Eta         int         `json:"eta"`       // halving reduction factor
+	Seed        int64       `json:"seed"`
+	Workers     int         `json:"workers"`     // trials run in parallel
+	MaxIndexes  int         `json:"max_indexes"` // built indexes kept for reuse; 0 keeps all
+	Leaderboard string      `json:"leaderboard"` // .csv for CSV, JSON otherwise
+	Space       SearchSpace `json:"space"`
+}
+
+// DefaultConfig returns the settings used for fields a config file leaves
+// unset.
+func DefaultConfig() Config {
+	return Config{
+		Book:        "data/book.txt",
+		Eval:        "testdata/eval_cases.json",
+		Strategy:    "grid",
+		Objective:   eval.MetricKeywordF1,
+		Samples:     20,
+		Eta:         3,
+		Seed:        1,
+		Workers:     4,
+		Leaderboard: "leaderboard.json",
+	}
+}
+
+// LoadConfig reads a config file over DefaultConfig.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("read optimize config: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse optimize config: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks that the objective is a default eval metric that improves
+// as it rises.
+func (c Config) Validate() error {
+	for _, m := range eval.DefaultMetrics() {
+		if m.Name != c.Objective {
+			continue
+		}
+		if m.LowerIsBetter {
+			return fmt.Errorf("objective %q is lower-is-better and cannot be maximized", c.Objective)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown objective %q", c.Objective)
+}
+
+// ObjectiveCases returns the cases that can score objective: all of them,
+// or for an IR metric those with relevant passages. It fails if none can.
+func ObjectiveCases(objective string, cases []eval.TestCase) ([]eval.TestCase, error) {
+	if !eval.NeedsRelevance(objective) {
+		return cases, nil
+	}
+	var labeled []eval.TestCase
+	for _, c := range cases {
+		if len(c.RelevantPassages) > 0 {
+			labeled = append(labeled, c)
+		}
+	}
+	if len(labeled) == 0 {
+		return nil, fmt.Errorf("objective %q needs eval cases with relevant_passages, and none have them", objective)
+	}
+	return labeled, nil
+}
@@ -0,0 +1,38 @@
+package optimize
+
+import (
+	"testing"
+
+	"ragbook/internal/eval"
+)
+
+func TestValidateObjective(t *testing.T) {
+	for objective, ok := range map[string]bool{
+		eval.MetricKeywordF1:  true,
+		eval.MetricMRR:        true,
+		eval.MetricRedundancy: false,
+		"f1":                  false,
+	} {
+		cfg := DefaultConfig()
+		cfg.Objective = objective
+		if err := cfg.Validate(); (err == nil) != ok {
+			t.Errorf("Validate() with objective %q = %v", objective, err)
+		}
+	}
+}
+
+func TestObjectiveCases(t *testing.T) {
+	cases := []eval.TestCase{
+		{Query: "unlabeled"},
+		{Query: "labeled", RelevantPassages: []eval.Passage{{Text: "off with her head"}}},
+	}
+	if got, err := ObjectiveCases(eval.MetricKeywordF1, cases); err != nil || len(got) != 2 {
+		t.Errorf("keyword objective kept %d cases, %v; want all", len(got), err)
+	}
+	if got, err := ObjectiveCases(eval.MetricMRR, cases); err != nil || len(got) != 1 || got[0].Query != "labeled" {
+		t.Errorf("IR objective kept %+v, %v; want the labeled case", got, err)
+	}
+	if _, err := ObjectiveCases(eval.MetricMRR, cases[:1]); err == nil {
+		t.Error("IR objective accepted cases without relevant passages")
+	}
+}
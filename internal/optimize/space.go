@@ -0,0 +1,128 @@
+// Package optimize searches ingestion and retrieval parameters for the
+// configuration that maximizes an evaluation metric.
+package optimize
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Params is one point of the search space.
+type Params struct {
+	TopK          int     `json:"top_k"`
+	ChunkSize     int     `json:"chunk_size"`
+	ChunkOverlap  int     `json:"chunk_overlap"`
+	Threshold     float32 `json:"threshold"`
+	RetrievalMode string  `json:"retrieval_mode"`
+	Dim           int     `json:"dim"`
+}
+
+func (p Params) String() string {
+	return fmt.Sprintf("top_k=%d chunk=%d overlap=%d threshold=%.2f mode=%s dim=%d",
+		p.TopK, p.ChunkSize, p.ChunkOverlap, p.Threshold, p.RetrievalMode, p.Dim)
+}
+
+// SearchSpace lists the values tried for each parameter. Unset parameters
+// keep a single default value.
+type SearchSpace struct {
+	TopK          IntValues   `json:"top_k"`
+	ChunkSize     IntValues   `json:"chunk_size"`
+	ChunkOverlap  IntValues   `json:"chunk_overlap"`
+	Threshold     FloatValues `json:"threshold"`
+	RetrievalMode []string    `json:"retrieval_mode"`
+	Dim           IntValues   `json:"dim"`
+}
+
+// Grid returns every combination in the space, skipping those whose overlap
+// is not smaller than the chunk size.
+func (s SearchSpace) Grid() []Params {
+	topK := orDefault(s.TopK, 3)
+	sizes := orDefault(s.ChunkSize, 800)
+	overlaps := orDefault(s.ChunkOverlap, 200)
+	thresholds := orDefault(s.Threshold, 0)
+	modes := orDefault(s.RetrievalMode, "vector")
+	dims := orDefault(s.Dim, 512)
+
+	var out []Params
+	for _, dim := range dims {
+		for _, size := range sizes {
+			for _, overlap := range overlaps {
+				if overlap >= size {
+					continue
+				}
+				for _, mode := range modes {
+					for _, k := range topK {
+						for _, t := range thresholds {
+							out = append(out, Params{
+								TopK:          k,
+								ChunkSize:     size,
+								ChunkOverlap:  overlap,
+								Threshold:     float32(t),
+								RetrievalMode: mode,
+								Dim:           dim,
+							})
+						}
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+func orDefault[T any](values []T, def T) []T {
+	if len(values) == 0 {
+		return []T{def}
+	}
+	return values
+}
+
+// IntValues decodes from a JSON list of integers or from a range object
+// {"min": 400, "max": 1200, "step": 200}, both ends inclusive.
+type IntValues []int
+
+func (v *IntValues) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, (*[]int)(v))
+	}
+	var r struct{ Min, Max, Step int }
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	if r.Step <= 0 || r.Max < r.Min {
+		return fmt.Errorf("invalid range %s: need min <= max and step > 0", data)
+	}
+	*v = nil
+	for x := r.Min; x <= r.Max; x += r.Step {
+		*v = append(*v, x)
+	}
+	return nil
+}
+
+// FloatValues decodes like IntValues. Range values are rounded to six
+// decimals so 0.1 steps do not accumulate error.
+type FloatValues []float64
+
+func (v *FloatValues) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, (*[]float64)(v))
+	}
+	var r struct{ Min, Max, Step float64 }
+	if err := json.Unmarshal(data, &r); err != nil {
+		return err
+	}
+	if r.Step <= 0 || r.Max < r.Min {
+		return fmt.Errorf("invalid range %s: need min <= max and step > 0", data)
+	}
+	*v = nil
+	for i := 0; ; i++ {
+		x := math.Round((r.Min+float64(i)*r.Step)*1e6) / 1e6
+		if x > r.Max+1e-9 {
+			break
+		}
+		*v = append(*v, x)
+	}
+	return nil
+}
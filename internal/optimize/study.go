@@ -0,0 +1,254 @@
+package optimize
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ragbook/internal/eval"
+	"ragbook/internal/parallel"
+)
+
+// Evaluator scores one parameter set on the given cases.
+type Evaluator func(ctx context.Context, p Params, cases []eval.TestCase) (*eval.Result, error)
+
+// Trial is one evaluation of a parameter set.
+type Trial struct {
+	Params   Params             `json:"params"`
+	Score    float64            `json:"score"` // the objective metric's average
+	Averages map[string]float64 `json:"averages"`
+	Cases    int                `json:"cases"` // number of eval cases used
+	Rung     int                `json:"rung"`  // successive-halving round; 0 otherwise
+}
+
+// Study couples the eval cases, the objective and how to evaluate a
+// parameter set. Up to Workers trials run at once (default 1). Progress, if
+// set, is called after every trial, one call at a time.
+type Study struct {
+	Cases     []eval.TestCase
+	Objective string
+	Evaluate  Evaluator
+	Workers   int
+	Progress  func(Trial)
+
+	progressMu sync.Mutex
+}
+
+// runTrials evaluates every candidate on cases with a bounded worker pool
+// and returns the trials in candidate order. The first error cancels the
+// remaining trials.
+func (s *Study) runTrials(ctx context.Context, candidates []Params, cases []eval.TestCase, rung int) ([]Trial, error) {
+	return parallel.Map(ctx, len(candidates), s.Workers, func(ctx context.Context, i int) (Trial, error) {
+		return s.trial(ctx, candidates[i], cases, rung)
+	})
+}
+
+func (s *Study) trial(ctx context.Context, p Params, cases []eval.TestCase, rung int) (Trial, error) {
+	res, err := s.Evaluate(ctx, p, cases)
+	if err != nil {
+		return Trial{}, fmt.Errorf("%v: %w", p, err)
+	}
+	score, ok := res.Averages[s.Objective]
+	if !ok {
+		return Trial{}, fmt.Errorf("objective %q was not reported for %v", s.Objective, p)
+	}
+	t := Trial{Params: p, Score: score, Averages: res.Averages, Cases: len(cases), Rung: rung}
+	if s.Progress != nil {
+		s.progressMu.Lock()
+		s.Progress(t)
+		s.progressMu.Unlock()
+	}
+	return t, nil
+}
+
+// Strategy picks which candidates to evaluate and on how many cases.
+type Strategy interface {
+	Run(ctx context.Context, s *Study, candidates []Params) ([]Trial, error)
+}
+
+// ParseStrategy resolves "grid", "random" or "halving". samples bounds the
+// candidates tried by random and halving; eta is the halving reduction
+// factor.
+func ParseStrategy(name string, samples, eta int, seed int64) (Strategy, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "grid":
+		return Grid{}, nil
+	case "random":
+		return Random{Samples: samples, Seed: seed}, nil
+	case "halving", "successive_halving":
+		return SuccessiveHalving{Samples: samples, Eta: eta, Seed: seed}, nil
+	default:
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+}
+
+// Grid evaluates every candidate on all cases.
+type Grid struct{}
+
+func (Grid) Run(ctx context.Context, s *Study, candidates []Params) ([]Trial, error) {
+	return s.runTrials(ctx, candidates, s.Cases, 0)
+}
+
+// Random evaluates Samples candidates drawn without replacement.
+type Random struct {
+	Samples int
+	Seed    int64
+}
+
+func (r Random) Run(ctx context.Context, s *Study, candidates []Params) ([]Trial, error) {
+	return s.runTrials(ctx, byIngestKey(sample(candidates, r.Samples, r.Seed)), s.Cases, 0)
+}
+
+// SuccessiveHalving draws Samples candidates, evaluates them on a small
+// subset of the cases, keeps the best 1/Eta and repeats with Eta times as
+// many cases until the survivors have been evaluated on all of them.
+type SuccessiveHalving struct {
+	Samples int
+	Eta     int // default 3
+	Seed    int64
+}
+
+func (h SuccessiveHalving) Run(ctx context.Context, s *Study, candidates []Params) ([]Trial, error) {
+	eta := h.Eta
+	if eta < 2 {
+		eta = 3
+	}
+	cands := sample(candidates, h.Samples, h.Seed)
+	if len(cands) == 0 || len(s.Cases) == 0 {
+		return nil, nil
+	}
+
+	// Shuffle once so every rung's prefix is a representative subset.
+	cases := append([]eval.TestCase(nil), s.Cases...)
+	rand.New(rand.NewSource(h.Seed)).Shuffle(len(cases), func(i, j int) { cases[i], cases[j] = cases[j], cases[i] })
+
+	rungs := 0
+	for n := len(cands); n > 1; n = (n + eta - 1) / eta {
+		rungs++
+	}
+	budget := len(cases)
+	for i := 0; i < rungs; i++ {
+		budget = (budget + eta - 1) / eta
+	}
+
+	var all []Trial
+	for rung := 0; ; rung++ {
+		trials, err := s.runTrials(ctx, byIngestKey(cands), cases[:budget], rung)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, trials...)
+		if budget == len(cases) {
+			return all, nil
+		}
+
+		sortTrials(trials)
+		keep := max(len(cands)/eta, 1)
+		cands = cands[:0]
+		for _, t := range trials[:keep] {
+			cands = append(cands, t.Params)
+		}
+		if keep == 1 {
+			budget = len(cases)
+		} else {
+			budget = min(budget*eta, len(cases))
+		}
+	}
+}
+
+// sample returns n candidates in random order, or all of them if n <= 0 or
+// there are fewer than n.
+func sample(candidates []Params, n int, seed int64) []Params {
+	out := append([]Params(nil), candidates...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	if n > 0 && n < len(out) {
+		out = out[:n]
+	}
+	return out
+}
+
+// byIngestKey orders candidates so those sharing an index run together,
+// which keeps fewer indexes alive at once.
+func byIngestKey(candidates []Params) []Params {
+	out := append([]Params(nil), candidates...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].IngestKey(), out[j].IngestKey()
+		if a.Dim != b.Dim {
+			return a.Dim < b.Dim
+		}
+		if a.ChunkSize != b.ChunkSize {
+			return a.ChunkSize < b.ChunkSize
+		}
+		return a.ChunkOverlap < b.ChunkOverlap
+	})
+	return out
+}
+
+// Leaderboard ranks trials best first, keeping only the last trial of each
+// parameter set: later halving rungs, which saw more cases, rank above
+// earlier ones, then by score.
+func Leaderboard(trials []Trial) []Trial {
+	latest := make(map[Params]int)
+	var out []Trial
+	for _, t := range trials {
+		if i, ok := latest[t.Params]; ok {
+			if t.Rung >= out[i].Rung {
+				out[i] = t
+			}
+			continue
+		}
+		latest[t.Params] = len(out)
+		out = append(out, t)
+	}
+	sortTrials(out)
+	return out
+}
+
+func sortTrials(trials []Trial) {
+	sort.SliceStable(trials, func(i, j int) bool {
+		if trials[i].Rung != trials[j].Rung {
+			return trials[i].Rung > trials[j].Rung
+		}
+		return trials[i].Score > trials[j].Score
+	})
+}
+
+// WriteLeaderboard writes ranked trials as JSON, or as CSV when format is
+// "csv".
+func WriteLeaderboard(w io.Writer, format, objective string, trials []Trial) error {
+	if format != "csv" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Objective string  `json:"objective"`
+			Trials    []Trial `json:"trials"`
+		}{objective, trials})
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"rank", objective, "cases", "rung", "top_k", "chunk_size", "chunk_overlap", "threshold", "retrieval_mode", "dim"})
+	for i, t := range trials {
+		p := t.Params
+		cw.Write([]string{
+			strconv.Itoa(i + 1),
+			strconv.FormatFloat(t.Score, 'f', 4, 64),
+			strconv.Itoa(t.Cases),
+			strconv.Itoa(t.Rung),
+			strconv.Itoa(p.TopK),
+			strconv.Itoa(p.ChunkSize),
+			strconv.Itoa(p.ChunkOverlap),
+			strconv.FormatFloat(float64(p.Threshold), 'f', -1, 32),
+			p.RetrievalMode,
+			strconv.Itoa(p.Dim),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
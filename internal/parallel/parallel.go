@@ -0,0 +1,59 @@
+// Package parallel runs independent jobs on a bounded number of goroutines.
+package parallel
+
+import (
+	"context"
+	"sync"
+)
+
+// Map calls fn for each i in [0, n) on up to workers goroutines (at least
+// one) and returns the results in index order. The first error cancels the
+// context passed to the remaining calls, and no further calls start; Map
+// then returns that error, not the cancellation errors it causes in calls
+// still running, or ctx's error if ctx was done.
+func Map[T any](ctx context.Context, n, workers int, fn func(ctx context.Context, i int) (T, error)) ([]T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]T, n)
+	var (
+		once     sync.Once
+		firstErr error
+	)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(workers, 1), n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				var err error
+				results[i], err = fn(ctx, i)
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
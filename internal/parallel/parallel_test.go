@@ -0,0 +1,75 @@
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMapKeepsOrderAndBound(t *testing.T) {
+	var running, peak atomic.Int32
+	got, err := Map(context.Background(), 50, 4, func(ctx context.Context, i int) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		return i * i, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got {
+		if v != i*i {
+			t.Fatalf("result %d = %d, want %d", i, v, i*i)
+		}
+	}
+	if p := peak.Load(); p > 4 {
+		t.Errorf("%d calls ran at once, want at most 4", p)
+	}
+}
+
+func TestMapStopsAtFirstError(t *testing.T) {
+	boom := errors.New("boom")
+	var calls atomic.Int32
+	_, err := Map(context.Background(), 100, 1, func(ctx context.Context, i int) (int, error) {
+		calls.Add(1)
+		if i == 3 {
+			return 0, boom
+		}
+		return i, ctx.Err()
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("err = %v, want boom", err)
+	}
+	// A call already handed to the worker may still start.
+	if n := calls.Load(); n < 4 || n > 5 {
+		t.Errorf("made %d calls, want 4 or 5", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Map(ctx, 3, 2, func(ctx context.Context, i int) (int, error) { return i, nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Map: err = %v", err)
+	}
+}
+
+func TestMapReturnsCauseNotCancellation(t *testing.T) {
+	boom := errors.New("boom")
+	// Call 0 only fails once call 1's error has cancelled it, so its
+	// context.Canceled comes later but at a lower index.
+	_, err := Map(context.Background(), 2, 2, func(ctx context.Context, i int) (int, error) {
+		if i == 1 {
+			return 0, boom
+		}
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("err = %v, want boom", err)
+	}
+}
@@ -0,0 +1,279 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// TextChunk is a passage cut from a document. Start and End are rune offsets
+// into the chunked text.
+type TextChunk struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Chunker splits a document into passages that are embedded and indexed
+// individually.
+type Chunker interface {
+	Chunk(text string) []TextChunk
+}
+
+// ChunkStrategy selects a Chunker implementation in IngestConfig.
+type ChunkStrategy string
+
+const (
+	// ChunkFixed cuts the text into fixed-size rune windows.
+	ChunkFixed ChunkStrategy = "fixed"
+	// ChunkStructured packs whole sentences, respecting paragraph breaks.
+	ChunkStructured ChunkStrategy = "structured"
+)
+
+// ParseChunkStrategy resolves a strategy name; the empty string means fixed.
+func ParseChunkStrategy(name string) (ChunkStrategy, error) {
+	switch s := ChunkStrategy(strings.ToLower(strings.TrimSpace(name))); s {
+	case "", ChunkFixed:
+		return ChunkFixed, nil
+	case ChunkStructured:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown chunk strategy %q", name)
+	}
+}
+
+// NewChunker returns the chunker selected by cfg. The overlap must be
+// smaller than a positive chunk size.
+func NewChunker(cfg IngestConfig) (Chunker, error) {
+	strategy, err := ParseChunkStrategy(string(cfg.Chunker))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if cfg.ChunkSize > 0 && cfg.ChunkOverlap >= cfg.ChunkSize {
+		return nil, fmt.Errorf("%w: chunk_overlap %d must be smaller than chunk_size %d", ErrInvalidConfig, cfg.ChunkOverlap, cfg.ChunkSize)
+	}
+	switch strategy {
+	case ChunkStructured:
+		return StructuredChunker{Size: cfg.ChunkSize, Overlap: cfg.ChunkOverlap}, nil
+	default:
+		return FixedChunker{Size: cfg.ChunkSize, Overlap: cfg.ChunkOverlap}, nil
+	}
+}
+
+// FixedChunker slices text into windows of Size runes, each starting
+// Overlap runes before the end of the previous one.
+type FixedChunker struct {
+	Size    int
+	Overlap int
+}
+
+func (c FixedChunker) Chunk(text string) []TextChunk {
+	return chunkText(text, c.Size, c.Overlap)
+}
+
+// StructuredChunker splits text into paragraphs and sentences and packs
+// consecutive sentences into chunks of at most Size runes. Consecutive chunks
+// share the trailing whole sentences that fit in Overlap runes. Sentences
+// longer than Size are split on word boundaries.
+type StructuredChunker struct {
+	Size    int
+	Overlap int
+}
+
+func (c StructuredChunker) Chunk(text string) []TextChunk {
+	runes := []rune(text)
+	units := splitUnits(runes, c.Size)
+	if len(units) == 0 {
+		return nil
+	}
+
+	var chunks []TextChunk
+	length := func(i, j int) int { return units[j].end - units[i].start }
+
+	for first := 0; first < len(units); {
+		last := first
+		for last+1 < len(units) && (c.Size <= 0 || length(first, last+1) <= c.Size) {
+			last++
+		}
+		start, end := units[first].start, units[last].end
+		chunks = append(chunks, TextChunk{Text: string(runes[start:end]), Start: start, End: end})
+		if last == len(units)-1 {
+			break
+		}
+
+		// Carry over the trailing sentences that fit in the overlap budget,
+		// as long as the next chunk still has room for a new sentence. The
+		// next chunk always starts at least one sentence later, whatever
+		// the overlap.
+		next := last + 1
+		for next-1 > first && length(next-1, last) <= c.Overlap &&
+			(c.Size <= 0 || length(next-1, last+1) <= c.Size) {
+			next--
+		}
+		first = next
+	}
+	return chunks
+}
+
+// span is a half-open rune range [start, end) of the source text.
+type span struct {
+	start, end int
+}
+
+// splitUnits returns sentence spans in document order. Sentences longer than
+// maxLen runes are further split on whitespace.
+func splitUnits(runes []rune, maxLen int) []span {
+	var units []span
+	for _, p := range splitParagraphs(runes) {
+		for _, s := range splitSentences(runes, p) {
+			if maxLen > 0 && s.end-s.start > maxLen {
+				units = append(units, splitLong(runes, s, maxLen)...)
+			} else {
+				units = append(units, s)
+			}
+		}
+	}
+	return units
+}
+
+// splitParagraphs returns the trimmed spans of text separated by blank lines.
+func splitParagraphs(runes []rune) []span {
+	var paras []span
+	start := -1
+	lastNonSpace := -1
+	newlines := 0
+	for i, r := range runes {
+		switch {
+		case r == '\n':
+			newlines++
+		case unicode.IsSpace(r):
+		default:
+			if start >= 0 && newlines >= 2 {
+				paras = append(paras, span{start, lastNonSpace + 1})
+				start = -1
+			}
+			if start < 0 {
+				start = i
+			}
+			lastNonSpace = i
+			newlines = 0
+		}
+	}
+	if start >= 0 {
+		paras = append(paras, span{start, lastNonSpace + 1})
+	}
+	return paras
+}
+
+// abbreviations that end in a period without ending the sentence.
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "st": true, "prof": true,
+	"sr": true, "jr": true, "vs": true, "etc": true, "vol": true, "cf": true,
+	"e.g": true, "i.e": true,
+}
+
+// splitSentences splits a paragraph span into trimmed sentence spans.
+func splitSentences(runes []rune, p span) []span {
+	var out []span
+	start := p.start
+	for i := p.start; i < p.end; i++ {
+		if !isSentenceEnd(runes[i]) {
+			continue
+		}
+		j := i + 1
+		for j < p.end && isSentenceEnd(runes[j]) {
+			j++
+		}
+		for j < p.end && isClosingPunct(runes[j]) {
+			j++
+		}
+		if j < p.end && !unicode.IsSpace(runes[j]) {
+			continue
+		}
+		if runes[i] == '.' && isAbbreviation(runes, p.start, i) {
+			continue
+		}
+		if next := skipSpace(runes, j, p.end); next < p.end && unicode.IsLower(runes[next]) {
+			// "Oh dear!" said the Rabbit — the quote does not end the sentence.
+			continue
+		}
+		out = append(out, span{start, j})
+		start = skipSpace(runes, j, p.end)
+		i = start - 1
+	}
+	if start < p.end {
+		out = append(out, span{start, p.end})
+	}
+	return out
+}
+
+// splitLong breaks an oversized sentence into pieces of at most maxLen runes,
+// cutting at the last whitespace inside each window where possible.
+func splitLong(runes []rune, s span, maxLen int) []span {
+	var out []span
+	start := s.start
+	for s.end-start > maxLen {
+		cut := start + maxLen
+		for k := cut; k > start; k-- {
+			if unicode.IsSpace(runes[k]) {
+				cut = k
+				break
+			}
+		}
+		end := cut
+		for end > start && unicode.IsSpace(runes[end-1]) {
+			end--
+		}
+		out = append(out, span{start, end})
+		start = skipSpace(runes, cut, s.end)
+	}
+	if start < s.end {
+		out = append(out, span{start, s.end})
+	}
+	return out
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?'
+}
+
+func isClosingPunct(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '”', '’', '»':
+		return true
+	}
+	return false
+}
+
+func isAbbreviation(runes []rune, lo, dot int) bool {
+	k := dot
+	for k > lo && (unicode.IsLetter(runes[k-1]) || runes[k-1] == '.') {
+		k--
+	}
+	word := strings.ToLower(string(runes[k:dot]))
+	if abbreviations[word] {
+		return true
+	}
+	// Single capital letters other than "I" are initials ("J. Smith").
+	return dot-k == 1 && unicode.IsUpper(runes[k]) && runes[k] != 'I'
+}
+
+func skipSpace(runes []rune, i, end int) int {
+	for i < end && unicode.IsSpace(runes[i]) {
+		i++
+	}
+	return i
+}
+
+// normalizeParagraphs collapses whitespace inside each paragraph while
+// keeping a blank line between paragraphs, so structure-aware chunkers can
+// still see paragraph breaks.
+func normalizeParagraphs(s string) string {
+	runes := []rune(s)
+	paras := splitParagraphs(runes)
+	out := make([]string, 0, len(paras))
+	for _, p := range paras {
+		out = append(out, normalizeSpaces(string(runes[p.start:p.end])))
+	}
+	return strings.Join(out, "\n\n")
+}
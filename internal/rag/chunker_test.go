@@ -0,0 +1,97 @@
+package rag
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewChunkerRejectsOverlapAsLargeAsSize(t *testing.T) {
+	for _, strategy := range []ChunkStrategy{ChunkFixed, ChunkStructured} {
+		for _, overlap := range []int{100, 900} {
+			_, err := NewChunker(IngestConfig{ChunkSize: 100, ChunkOverlap: overlap, Chunker: strategy})
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("%s chunker with overlap %d: err = %v, want ErrInvalidConfig", strategy, overlap, err)
+			}
+		}
+	}
+}
+
+func TestChunkersAlwaysMoveForward(t *testing.T) {
+	text := strings.Repeat("Alice ran. ", 50)
+	for _, c := range []Chunker{FixedChunker{Size: 10, Overlap: 20}, StructuredChunker{Size: 10, Overlap: 20}} {
+		chunks := c.Chunk(text)
+		if len(chunks) == 0 || len(chunks) > len([]rune(text)) {
+			t.Fatalf("%T made %d chunks of %d runes", c, len(chunks), len([]rune(text)))
+		}
+		for i := 1; i < len(chunks); i++ {
+			if chunks[i].Start <= chunks[i-1].Start {
+				t.Fatalf("%T: chunk %d starts at %d, not after %d", c, i, chunks[i].Start, chunks[i-1].Start)
+			}
+		}
+		if last := chunks[len(chunks)-1]; last.End != len([]rune(text))-1 && last.End != len([]rune(text)) {
+			t.Errorf("%T: last chunk ends at %d of %d", c, last.End, len([]rune(text)))
+		}
+	}
+}
+
+func TestStructuredChunkerBoundaries(t *testing.T) {
+	text := "  Mr. Dodgson wrote it. \"Oh dear!\" said the Rabbit. J. Smith? No.\n" +
+		"It was late.\n\n\n  Alice followed. She fell.  \n"
+	runes := []rune(text)
+
+	var paras []string
+	for _, p := range splitParagraphs(runes) {
+		paras = append(paras, string(runes[p.start:p.end]))
+	}
+	wantParas := []string{
+		"Mr. Dodgson wrote it. \"Oh dear!\" said the Rabbit. J. Smith? No.\nIt was late.",
+		"Alice followed. She fell.",
+	}
+	if !slices.Equal(paras, wantParas) {
+		t.Errorf("paragraphs = %q, want %q", paras, wantParas)
+	}
+
+	// Abbreviations, initials and a quote followed by lowercase do not end
+	// a sentence; a paragraph break always does.
+	var sentences []string
+	for _, s := range splitUnits(runes, 0) {
+		sentences = append(sentences, string(runes[s.start:s.end]))
+	}
+	wantSentences := []string{
+		"Mr. Dodgson wrote it.", "\"Oh dear!\" said the Rabbit.", "J. Smith?", "No.", "It was late.",
+		"Alice followed.", "She fell.",
+	}
+	if !slices.Equal(sentences, wantSentences) {
+		t.Errorf("sentences = %q, want %q", sentences, wantSentences)
+	}
+
+	// Chunks hold whole sentences and carry trailing ones over as overlap
+	// when the next chunk still has room for a new one.
+	for _, tt := range []struct {
+		text string
+		c    StructuredChunker
+		want []string
+	}{
+		{text, StructuredChunker{Size: 30, Overlap: 15}, []string{
+			"Mr. Dodgson wrote it.", "\"Oh dear!\" said the Rabbit.", "J. Smith? No.\nIt was late.",
+			"Alice followed. She fell.",
+		}},
+		{"One. Two. Three. Four.", StructuredChunker{Size: 11, Overlap: 4}, []string{
+			"One. Two.", "Two. Three.", "Four.",
+		}},
+	} {
+		runes := []rune(tt.text)
+		var chunks []string
+		for _, c := range tt.c.Chunk(tt.text) {
+			if c.Text != string(runes[c.Start:c.End]) {
+				t.Errorf("chunk %q does not match its span [%d, %d)", c.Text, c.Start, c.End)
+			}
+			chunks = append(chunks, c.Text)
+		}
+		if !slices.Equal(chunks, tt.want) {
+			t.Errorf("%+v chunks = %q, want %q", tt.c, chunks, tt.want)
+		}
+	}
+}
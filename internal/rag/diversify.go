@@ -0,0 +1,117 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+// Diversity selects how AnswerQuery avoids returning near-duplicate chunks.
+type Diversity string
+
+const (
+	// DiversityNone returns the top-ranked chunks as they are.
+	DiversityNone Diversity = "none"
+	// DiversityMMR re-ranks candidates by maximal marginal relevance,
+	// trading relevance against similarity to the chunks already picked.
+	DiversityMMR Diversity = "mmr"
+	// DiversityDedupe drops chunks whose span overlaps a better-ranked
+	// chunk of the same book, such as the adjacent windows of the fixed
+	// chunker.
+	DiversityDedupe Diversity = "dedupe"
+)
+
+const (
+	// DefaultMMRLambda weights relevance against diversity when a request
+	// sets no lambda: 1 is pure relevance, 0 pure diversity.
+	DefaultMMRLambda = 0.7
+	// diversifyFetchFactor is how many candidates per requested result
+	// are retrieved for diversification to choose from.
+	diversifyFetchFactor = 3
+	minDiversifyFetch    = 10
+)
+
+// ParseDiversity resolves a diversity mode; the empty string means none.
+func ParseDiversity(name string) (Diversity, error) {
+	switch d := Diversity(strings.ToLower(strings.TrimSpace(name))); d {
+	case "", DiversityNone:
+		return DiversityNone, nil
+	case DiversityMMR, DiversityDedupe:
+		return d, nil
+	default:
+		return "", fmt.Errorf("unknown diversity mode %q", name)
+	}
+}
+
+// mmr picks topK candidates greedily, each maximizing
+// lambda*relevance - (1-lambda)*max similarity to those already picked.
+// Relevance is the min-max normalized score, so lambda means the same for
+// every retrieval mode; similarity is the cosine of the chunk embeddings.
+func mmr(candidates []types.SourceChunk, topK int, lambda float32) []types.SourceChunk {
+	lo, hi := scoreRange(candidates)
+	relevance := func(s *types.SourceChunk) float32 {
+		if hi <= lo {
+			return 1
+		}
+		return (s.Score - lo) / (hi - lo)
+	}
+
+	picked := make([]types.SourceChunk, 0, min(topK, len(candidates)))
+	left := append([]types.SourceChunk(nil), candidates...)
+	maxSim := make([]float32, len(left)) // to the picked chunks so far
+	for len(picked) < topK && len(left) > 0 {
+		best, bestScore := 0, float32(0)
+		for i := range left {
+			score := lambda*relevance(&left[i]) - (1-lambda)*maxSim[i]
+			if i == 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		chosen := left[best]
+		picked = append(picked, chosen)
+		left = append(left[:best], left[best+1:]...)
+		maxSim = append(maxSim[:best], maxSim[best+1:]...)
+		for i := range left {
+			maxSim[i] = max(maxSim[i], similarity(&chosen, &left[i]))
+		}
+	}
+	return picked
+}
+
+// similarity is the cosine of two chunks' embeddings, or 0 if either has
+// none.
+func similarity(a, b *types.SourceChunk) float32 {
+	if len(a.Embedding) == 0 || len(a.Embedding) != len(b.Embedding) {
+		return 0
+	}
+	return store.CosineSimilarity(a.Embedding, b.Embedding)
+}
+
+// dedupeOverlapping returns the first topK candidates in rank order that do
+// not overlap an earlier kept chunk of the same book.
+func dedupeOverlapping(candidates []types.SourceChunk, topK int) []types.SourceChunk {
+	kept := make([]types.SourceChunk, 0, min(topK, len(candidates)))
+	for _, c := range candidates {
+		if len(kept) == topK {
+			break
+		}
+		dup := false
+		for _, k := range kept {
+			if overlaps(k, c) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// overlaps reports whether two sources share part of the same book's text.
+func overlaps(a, b types.SourceChunk) bool {
+	return a.BookID == b.BookID && a.StartOffset < b.EndOffset && b.StartOffset < a.EndOffset
+}
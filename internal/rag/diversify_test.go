@@ -0,0 +1,61 @@
+package rag
+
+import (
+	"slices"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+func ids(sources []types.SourceChunk) []string {
+	var out []string
+	for _, s := range sources {
+		out = append(out, s.ID)
+	}
+	return out
+}
+
+func TestMMR(t *testing.T) {
+	// b is a near copy of a; c is less relevant but about something else.
+	candidates := []types.SourceChunk{
+		{ID: "a", Score: 1, Embedding: []float32{1, 0}},
+		{ID: "b", Score: 0.95, Embedding: []float32{1, 0}},
+		{ID: "c", Score: 0.5, Embedding: []float32{0, 1}},
+	}
+	tests := []struct {
+		lambda float32
+		want   []string
+	}{
+		{1, []string{"a", "b"}},
+		{0.5, []string{"a", "c"}},
+		{0, []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		if got := ids(mmr(candidates, 2, tt.lambda)); !slices.Equal(got, tt.want) {
+			t.Errorf("mmr(lambda=%v) = %v, want %v", tt.lambda, got, tt.want)
+		}
+	}
+
+	// Without embeddings nothing looks similar, so MMR keeps the ranking.
+	for i := range candidates {
+		candidates[i].Embedding = nil
+	}
+	if got := ids(mmr(candidates, 3, 0.5)); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("mmr without embeddings = %v", got)
+	}
+}
+
+func TestDedupeOverlapping(t *testing.T) {
+	candidates := []types.SourceChunk{
+		{ID: "a", BookID: "alice", StartOffset: 0, EndOffset: 10},
+		{ID: "b", BookID: "alice", StartOffset: 5, EndOffset: 15}, // overlaps a
+		{ID: "c", BookID: "bob", StartOffset: 5, EndOffset: 15},   // other book
+		{ID: "d", BookID: "alice", StartOffset: 10, EndOffset: 20},
+	}
+	if got := ids(dedupeOverlapping(candidates, 3)); !slices.Equal(got, []string{"a", "c", "d"}) {
+		t.Errorf("dedupeOverlapping = %v, want [a c d]", got)
+	}
+	if got := ids(dedupeOverlapping(candidates, 2)); !slices.Equal(got, []string{"a", "c"}) {
+		t.Errorf("dedupeOverlapping(topK=2) = %v, want [a c]", got)
+	}
+}
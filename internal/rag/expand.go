@@ -0,0 +1,118 @@
+package rag
+
+import (
+	"slices"
+
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+// MaxExpand bounds QueryRequest.Expand.
+const MaxExpand = 5
+
+// expandSources replaces each hit with a passage stitched from the hit and
+// up to n chunks before and after it in the same book. Hits whose windows
+// overlap or touch are merged into one passage that keeps the rank, score,
+// ID and chapter of the better hit, so fewer sources than hits may be
+// returned.
+func expandSources(vs store.VectorStore, sources []types.SourceChunk, n int) []types.SourceChunk {
+	if n <= 0 || len(sources) == 0 {
+		return sources
+	}
+
+	type window struct {
+		hit    types.SourceChunk
+		lo, hi int
+	}
+	var windows []*window
+	for _, s := range sources {
+		lo, hi := s.Index, s.Index
+		for lo > s.Index-n && hasChunk(vs, s.BookID, lo-1) {
+			lo--
+		}
+		for hi < s.Index+n && hasChunk(vs, s.BookID, hi+1) {
+			hi++
+		}
+
+		// Merge into the best-ranked window this one overlaps or touches,
+		// folding in any other windows it bridges. Windows stay in rank
+		// order because a merge keeps the earlier one.
+		var into *window
+		kept := windows[:0]
+		for _, w := range windows {
+			if w.hit.BookID != s.BookID || lo > w.hi+1 || hi < w.lo-1 {
+				kept = append(kept, w)
+				continue
+			}
+			if into == nil {
+				into = w
+				kept = append(kept, w)
+			}
+			into.lo, into.hi = min(into.lo, w.lo, lo), max(into.hi, w.hi, hi)
+		}
+		windows = kept
+		if into == nil {
+			windows = append(windows, &window{hit: s, lo: lo, hi: hi})
+		}
+	}
+
+	out := make([]types.SourceChunk, 0, len(windows))
+	for _, w := range windows {
+		chunks := make([]types.DocumentChunk, 0, w.hi-w.lo+1)
+		for i := w.lo; i <= w.hi; i++ {
+			if c, ok := vs.GetChunk(w.hit.BookID, i); ok {
+				chunks = append(chunks, c)
+			}
+		}
+		if len(chunks) < 2 {
+			out = append(out, w.hit)
+			continue
+		}
+		src := w.hit
+		src.Text, src.StartOffset, src.EndOffset = stitch(chunks)
+		src.ChunkIndexes = make([]int, len(chunks))
+		for i, c := range chunks {
+			src.ChunkIndexes[i] = c.Index
+		}
+		out = append(out, src)
+	}
+	return out
+}
+
+func hasChunk(vs store.VectorStore, bookID string, index int) bool {
+	if index < 0 {
+		return false
+	}
+	_, ok := vs.GetChunk(bookID, index)
+	return ok
+}
+
+// stitch joins consecutive chunks into one text, dropping the region each
+// chunk shares with the previous one, and returns the text with its span.
+// Offsets count runes of the book as given, which may hold more whitespace
+// than the normalized chunk texts, so they only bound the shared region:
+// it is the longest end of the text so far, no longer than the offsets
+// overlap, that the next chunk starts with.
+func stitch(chunks []types.DocumentChunk) (string, int, int) {
+	text := []rune(chunks[0].Text)
+	start, end := chunks[0].StartOffset, chunks[0].EndOffset
+	for _, c := range chunks[1:] {
+		if c.EndOffset <= end {
+			continue // nothing new
+		}
+		runes := []rune(c.Text)
+		shared := 0
+		for k := min(end-c.StartOffset, len(text), len(runes)); k > 0; k-- {
+			if slices.Equal(text[len(text)-k:], runes[:k]) {
+				shared = k
+				break
+			}
+		}
+		if shared == 0 {
+			text = append(text, ' ')
+		}
+		text = append(text, runes[shared:]...)
+		end = max(end, c.EndOffset)
+	}
+	return string(text), start, end
+}
@@ -0,0 +1,112 @@
+package rag
+
+import (
+	"slices"
+	"testing"
+
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+const alphabet = "abcdefghijklmnopqrstuvwxyz"
+
+// alphabetStore holds the alphabet of book "abc" in 6-letter chunks that
+// overlap by 2: "abcdef", "efghij", … , "yz".
+func alphabetStore(t *testing.T) *store.MemoryStore {
+	t.Helper()
+	vs := store.NewMemoryStore()
+	for i, c := range chunkText(alphabet, 6, 2) {
+		err := vs.AddChunk(types.DocumentChunk{
+			ID: "abc-" + string(rune('0'+i)), BookID: "abc", Index: i, Text: c.Text,
+			StartOffset: c.Start, EndOffset: c.End, Embedding: []float32{1},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vs
+}
+
+func hit(vs *store.MemoryStore, index int) types.SourceChunk {
+	c, _ := vs.GetChunk("abc", index)
+	return types.SourceChunk{ID: c.ID, BookID: c.BookID, Index: c.Index, Text: c.Text, StartOffset: c.StartOffset, EndOffset: c.EndOffset}
+}
+
+func TestExpandSources(t *testing.T) {
+	vs := alphabetStore(t) // chunks 0–5 start at 0, 4, 8, 12, 16 and 20
+	tests := []struct {
+		name    string
+		hits    []int
+		n       int
+		want    []string
+		indexes [][]int
+	}{
+		{"stitches neighbors without repeating the overlap", []int{2}, 1, []string{"efghijklmnopqr"}, [][]int{{1, 2, 3}}},
+		{"stops at the start of the book", []int{0}, 2, []string{"abcdefghijklmn"}, [][]int{{0, 1, 2}}},
+		{"stops at the end of the book", []int{5}, 2, []string{"mnopqrstuvwxyz"}, [][]int{{3, 4, 5}}},
+		{"merges overlapping windows into the better hit", []int{3, 1}, 1, []string{"abcdefghijklmnopqrstuv"}, [][]int{{0, 1, 2, 3, 4}}},
+		{"keeps separate windows apart", []int{1, 5}, 1, []string{"abcdefghijklmn", "qrstuvwxyz"}, [][]int{{0, 1, 2}, {4, 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits []types.SourceChunk
+			for _, i := range tt.hits {
+				hits = append(hits, hit(vs, i))
+			}
+			got := expandSources(vs, hits, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d sources, want %d", len(got), len(tt.want))
+			}
+			for i, s := range got {
+				if s.Text != tt.want[i] || !slices.Equal(s.ChunkIndexes, tt.indexes[i]) {
+					t.Errorf("source %d = %q from chunks %v, want %q from %v", i, s.Text, s.ChunkIndexes, tt.want[i], tt.indexes[i])
+				}
+				if s.Text != alphabet[s.StartOffset:s.EndOffset] {
+					t.Errorf("source %d spans %q, holds %q", i, alphabet[s.StartOffset:s.EndOffset], s.Text)
+				}
+			}
+			if got[0].ID != hits[0].ID {
+				t.Errorf("first source is %s, want the best hit %s", got[0].ID, hits[0].ID)
+			}
+		})
+	}
+}
+
+func TestStitch(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []types.DocumentChunk
+		want   string
+	}{
+		{
+			// The offsets count the book's double space, the texts do not.
+			name: "normalized whitespace",
+			chunks: []types.DocumentChunk{
+				{Text: "the Queen of Hearts", StartOffset: 0, EndOffset: 20},
+				{Text: "of Hearts made tarts", StartOffset: 11, EndOffset: 32},
+			},
+			want: "the Queen of Hearts made tarts",
+		},
+		{
+			name: "adjacent",
+			chunks: []types.DocumentChunk{
+				{Text: "Off with", StartOffset: 0, EndOffset: 8},
+				{Text: "her head", StartOffset: 9, EndOffset: 17},
+			},
+			want: "Off with her head",
+		},
+		{
+			name: "contained",
+			chunks: []types.DocumentChunk{
+				{Text: "Curiouser and curiouser", StartOffset: 0, EndOffset: 23},
+				{Text: "and", StartOffset: 10, EndOffset: 13},
+			},
+			want: "Curiouser and curiouser",
+		},
+	}
+	for _, tt := range tests {
+		if got, _, _ := stitch(tt.chunks); got != tt.want {
+			t.Errorf("%s: stitch = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
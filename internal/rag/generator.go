@@ -0,0 +1,104 @@
+package rag
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"ragbook/internal/types"
+)
+
+// Generator writes the answer to a query from the retrieved sources.
+type Generator interface {
+	Generate(ctx context.Context, query string, sources []types.SourceChunk) (string, error)
+}
+
+// StreamingGenerator is a Generator that can deliver the answer in pieces
+// as the model produces it. GenerateStream calls emit with each piece in
+// order and stops at the first error emit returns.
+type StreamingGenerator interface {
+	Generator
+	GenerateStream(ctx context.Context, query string, sources []types.SourceChunk, emit func(delta string) error) error
+}
+
+// ExtractiveGenerator answers by quoting the retrieved excerpts verbatim.
+// It needs no model and never fails.
+type ExtractiveGenerator struct{}
+
+func (ExtractiveGenerator) Generate(_ context.Context, query string, sources []types.SourceChunk) (string, error) {
+	return buildSimpleAnswer(query, sources), nil
+}
+
+// GenerateStream emits the extractive answer one excerpt at a time.
+func (g ExtractiveGenerator) GenerateStream(ctx context.Context, query string, sources []types.SourceChunk, emit func(string) error) error {
+	answer, _ := g.Generate(ctx, query, sources)
+	for _, part := range strings.SplitAfter(answer, "\n\n") {
+		if part == "" {
+			continue
+		}
+		if err := emit(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FallbackGenerator uses Primary and falls back to Fallback when Primary
+// returns an error, e.g. because the model server is unreachable.
+type FallbackGenerator struct {
+	Primary  Generator
+	Fallback Generator
+}
+
+func (g FallbackGenerator) Generate(ctx context.Context, query string, sources []types.SourceChunk) (string, error) {
+	answer, err := g.Primary.Generate(ctx, query, sources)
+	if err == nil {
+		return answer, nil
+	}
+	if ctx.Err() != nil {
+		return "", err
+	}
+	log.Printf("generator failed, falling back: %v", err)
+	return g.Fallback.Generate(ctx, query, sources)
+}
+
+// GenerateStream streams from Primary and falls back to Fallback if Primary
+// fails before emitting anything. Once part of an answer has been sent it
+// cannot be replaced, so later failures are returned.
+func (g FallbackGenerator) GenerateStream(ctx context.Context, query string, sources []types.SourceChunk, emit func(string) error) error {
+	emitted := false
+	err := streamAnswer(ctx, g.Primary, query, sources, func(delta string) error {
+		emitted = true
+		return emit(delta)
+	})
+	if err == nil || emitted || ctx.Err() != nil {
+		return err
+	}
+	log.Printf("generator failed, falling back: %v", err)
+	return streamAnswer(ctx, g.Fallback, query, sources, emit)
+}
+
+// streamAnswer streams from g if it supports it and otherwise emits its
+// whole answer at once.
+func streamAnswer(ctx context.Context, g Generator, query string, sources []types.SourceChunk, emit func(string) error) error {
+	if sg, ok := g.(StreamingGenerator); ok {
+		return sg.GenerateStream(ctx, query, sources, emit)
+	}
+	answer, err := g.Generate(ctx, query, sources)
+	if err != nil {
+		return err
+	}
+	return emit(answer)
+}
+
+// Option configures a Pipeline.
+type Option func(*Pipeline)
+
+// WithGenerator sets the answer generator. The default is ExtractiveGenerator.
+func WithGenerator(g Generator) Option {
+	return func(p *Pipeline) {
+		if g != nil {
+			p.generator = g
+		}
+	}
+}
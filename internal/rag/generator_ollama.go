@@ -0,0 +1,108 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ragbook/internal/httpclient"
+	"ragbook/internal/types"
+)
+
+// OllamaGenerator answers with Ollama's /api/chat endpoint.
+type OllamaGenerator struct {
+	BaseURL     string // defaults to httpclient.DefaultOllamaBaseURL
+	Model       string
+	Temperature *float32     // nil leaves it to the model
+	Prompt      *Prompt      // defaults to DefaultPrompt
+	HTTPClient  *http.Client // defaults to http.DefaultClient
+}
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	Options  struct {
+		Temperature *float32 `json:"temperature,omitempty"`
+	} `json:"options"`
+}
+
+type ollamaChatResponse struct {
+	Message chatMessage `json:"message"`
+	Done    bool        `json:"done"`
+}
+
+func (g *OllamaGenerator) Generate(ctx context.Context, query string, sources []types.SourceChunk) (string, error) {
+	req, err := g.request(query, sources)
+	if err != nil {
+		return "", err
+	}
+	var resp ollamaChatResponse
+	if err := httpclient.PostJSON(ctx, g.HTTPClient, g.url(), nil, req, &resp); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Message.Content), nil
+}
+
+// GenerateStream requests a streamed chat and emits the content of each
+// newline-delimited JSON message.
+func (g *OllamaGenerator) GenerateStream(ctx context.Context, query string, sources []types.SourceChunk, emit func(string) error) error {
+	req, err := g.request(query, sources)
+	if err != nil {
+		return err
+	}
+	req.Stream = true
+	body, err := httpclient.PostStream(ctx, g.HTTPClient, g.url(), nil, req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var msg ollamaChatResponse
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return errors.New("chat stream ended before done")
+			}
+			return fmt.Errorf("decode stream message: %w", err)
+		}
+		if msg.Message.Content != "" {
+			if err := emit(msg.Message.Content); err != nil {
+				return err
+			}
+		}
+		if msg.Done {
+			return nil
+		}
+	}
+}
+
+func (g *OllamaGenerator) request(query string, sources []types.SourceChunk) (ollamaChatRequest, error) {
+	prompt := g.Prompt
+	if prompt == nil {
+		prompt = DefaultPrompt()
+	}
+	system, user, err := prompt.Render(query, sources)
+	if err != nil {
+		return ollamaChatRequest{}, err
+	}
+	req := ollamaChatRequest{
+		Model:    g.Model,
+		Messages: []chatMessage{{Role: "system", Content: system}, {Role: "user", Content: user}},
+	}
+	req.Options.Temperature = g.Temperature
+	return req, nil
+}
+
+func (g *OllamaGenerator) url() string {
+	base := g.BaseURL
+	if base == "" {
+		base = httpclient.DefaultOllamaBaseURL
+	}
+	return strings.TrimRight(base, "/") + "/api/chat"
+}
@@ -0,0 +1,134 @@
+package rag
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ragbook/internal/httpclient"
+	"ragbook/internal/types"
+)
+
+// OpenAIGenerator answers with an OpenAI-compatible /chat/completions
+// endpoint.
+type OpenAIGenerator struct {
+	BaseURL     string // defaults to httpclient.DefaultOpenAIBaseURL
+	APIKey      string
+	Model       string
+	Temperature *float32 // nil leaves it to the server
+	MaxTokens   int
+	Prompt      *Prompt      // defaults to DefaultPrompt
+	HTTPClient  *http.Client // defaults to http.DefaultClient
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature *float32      `json:"temperature,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Stream      bool          `json:"stream,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (g *OpenAIGenerator) Generate(ctx context.Context, query string, sources []types.SourceChunk) (string, error) {
+	req, err := g.request(query, sources)
+	if err != nil {
+		return "", err
+	}
+	var resp openAIChatResponse
+	if err := httpclient.PostJSON(ctx, g.HTTPClient, g.url(), httpclient.BearerHeader(g.APIKey), req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("chat completion returned no choices")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+// GenerateStream requests a streamed completion and emits the content of
+// each server-sent chunk.
+func (g *OpenAIGenerator) GenerateStream(ctx context.Context, query string, sources []types.SourceChunk, emit func(string) error) error {
+	req, err := g.request(query, sources)
+	if err != nil {
+		return err
+	}
+	req.Stream = true
+	body, err := httpclient.PostStream(ctx, g.HTTPClient, g.url(), httpclient.BearerHeader(g.APIKey), req)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("decode stream chunk: %w", err)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			if err := emit(chunk.Choices[0].Delta.Content); err != nil {
+				return err
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read stream: %w", err)
+	}
+	return errors.New("chat completion stream ended without [DONE]")
+}
+
+func (g *OpenAIGenerator) request(query string, sources []types.SourceChunk) (openAIChatRequest, error) {
+	prompt := g.Prompt
+	if prompt == nil {
+		prompt = DefaultPrompt()
+	}
+	system, user, err := prompt.Render(query, sources)
+	if err != nil {
+		return openAIChatRequest{}, err
+	}
+	return openAIChatRequest{
+		Model:       g.Model,
+		Messages:    []chatMessage{{Role: "system", Content: system}, {Role: "user", Content: user}},
+		Temperature: g.Temperature,
+		MaxTokens:   g.MaxTokens,
+	}, nil
+}
+
+func (g *OpenAIGenerator) url() string {
+	base := g.BaseURL
+	if base == "" {
+		base = httpclient.DefaultOpenAIBaseURL
+	}
+	return strings.TrimRight(base, "/") + "/chat/completions"
+}
@@ -0,0 +1,181 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+var testSources = []types.SourceChunk{{ID: "alice-0", BookID: "alice", Text: "The Queen shouted off with her head."}}
+
+// collect streams an answer from g and returns the emitted pieces.
+func collect(g StreamingGenerator) ([]string, error) {
+	var parts []string
+	err := g.GenerateStream(context.Background(), "who shouted?", testSources, func(delta string) error {
+		parts = append(parts, delta)
+		return nil
+	})
+	return parts, err
+}
+
+func TestOpenAIGenerator(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("request to %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":" The Queen [1]. "}}]}`)
+	}))
+	defer srv.Close()
+
+	g := &OpenAIGenerator{BaseURL: srv.URL + "/v1/", APIKey: "secret", Model: "m"}
+	answer, err := g.Generate(context.Background(), "who shouted?", testSources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "The Queen [1]." {
+		t.Errorf("answer = %q", answer)
+	}
+	if got["model"] != "m" || len(got["messages"].([]any)) != 2 {
+		t.Errorf("request = %v", got)
+	}
+	if _, ok := got["temperature"]; ok {
+		t.Errorf("unset temperature was sent: %v", got["temperature"])
+	}
+
+	zero := float32(0)
+	g.Temperature = &zero
+	if _, err := g.Generate(context.Background(), "who shouted?", testSources); err != nil {
+		t.Fatal(err)
+	}
+	if temp, ok := got["temperature"]; !ok || temp != 0.0 {
+		t.Errorf("temperature 0 sent as %v, %v", temp, ok)
+	}
+}
+
+func TestOpenAIGeneratorStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "complete",
+			body: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n" +
+				": keep-alive\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"The \"}}]}\n\n" +
+				"data:{\"choices\":[{\"delta\":{\"content\":\"Queen\"}}]}\n\n" +
+				"data: [DONE]\n\n",
+			want: []string{"The ", "Queen"},
+		},
+		{
+			name:    "cut off",
+			body:    "data: {\"choices\":[{\"delta\":{\"content\":\"The \"}}]}\n\n",
+			want:    []string{"The "},
+			wantErr: true,
+		},
+		{
+			name:    "bad chunk",
+			body:    "data: {\"choices\":\n\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req openAIChatRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				if !req.Stream {
+					t.Error("streaming request without stream: true")
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				// Send the events one line at a time so the client has to
+				// reassemble them from several reads.
+				for _, line := range strings.SplitAfter(tt.body, "\n") {
+					fmt.Fprint(w, line)
+					w.(http.Flusher).Flush()
+				}
+			}))
+			defer srv.Close()
+
+			parts, err := collect(&OpenAIGenerator{BaseURL: srv.URL})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(parts, tt.want) {
+				t.Errorf("emitted %q, want %q", parts, tt.want)
+			}
+		})
+	}
+}
+
+func TestOllamaGeneratorStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("request to %s", r.URL.Path)
+		}
+		for _, msg := range []string{
+			`{"message":{"role":"assistant","content":"Off with "},"done":false}`,
+			`{"message":{"role":"assistant","content":"her head"},"done":false}`,
+			`{"message":{"role":"assistant","content":""},"done":true}`,
+		} {
+			fmt.Fprintln(w, msg)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	parts, err := collect(&OllamaGenerator{BaseURL: srv.URL, Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Off with ", "her head"}; !slices.Equal(parts, want) {
+		t.Errorf("emitted %q, want %q", parts, want)
+	}
+}
+
+func TestGeneratorErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"model not found"}`+strings.Repeat(" padding", 200), http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	for _, g := range []StreamingGenerator{&OpenAIGenerator{BaseURL: srv.URL}, &OllamaGenerator{BaseURL: srv.URL}} {
+		_, err := g.Generate(context.Background(), "q", testSources)
+		if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "model not found") {
+			t.Errorf("%T: err = %v, want the status and body", g, err)
+		}
+		if err != nil && len(err.Error()) > 600 {
+			t.Errorf("%T: error quotes %d bytes of the body", g, len(err.Error()))
+		}
+		if _, err := collect(g); err == nil {
+			t.Errorf("%T: stream succeeded on a 404", g)
+		}
+	}
+}
+
+func TestFallbackGeneratorStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	g := FallbackGenerator{Primary: &OpenAIGenerator{BaseURL: srv.URL}, Fallback: ExtractiveGenerator{}}
+	parts, err := collect(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := strings.Join(parts, ""); !strings.Contains(answer, "off with her head") {
+		t.Errorf("fallback answer = %q, want the extractive one", answer)
+	}
+}
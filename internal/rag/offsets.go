@@ -0,0 +1,65 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// offsetMap maps rune offsets into the text a chunker split back to rune
+// offsets into the text given to IngestBook. Boilerplate stripping removes
+// whole lines and normalization only whitespace, so the non-space runes of
+// the chunked text are those of the kept input lines, in order. Mapping
+// through them keeps chunk offsets, and passages labeled with them, the
+// same whichever chunker and normalization produced the chunks.
+type offsetMap struct {
+	raw    []int // input offset of each non-space rune of the chunked text
+	before []int // non-space runes of the chunked text before each offset
+	rawLen int
+}
+
+// newOffsetMap maps chunked, made from input by keeping the lines at the
+// indexes in kept (all of them if kept is nil) and changing whitespace. It
+// reports false if chunked was not made that way.
+func newOffsetMap(input string, kept []int, chunked string) (offsetMap, bool) {
+	m := offsetMap{rawLen: utf8.RuneCountInString(input)}
+	lineStart, next := 0, 0
+	for i, line := range strings.Split(input, "\n") {
+		if kept == nil || (next < len(kept) && kept[next] == i) {
+			next++
+			j := lineStart
+			for _, r := range line {
+				if !unicode.IsSpace(r) {
+					m.raw = append(m.raw, j)
+				}
+				j++
+			}
+		}
+		lineStart += utf8.RuneCountInString(line) + 1
+	}
+
+	m.before = make([]int, 0, len(chunked)+1)
+	n := 0
+	for _, r := range chunked {
+		m.before = append(m.before, n)
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	m.before = append(m.before, n)
+	return m, n == len(m.raw)
+}
+
+// span maps the chunked-text span [start, end) to the input span from its
+// first to just past its last non-space rune.
+func (m offsetMap) span(start, end int) (int, int) {
+	s, e := m.before[start], m.before[end]
+	rawStart := m.rawLen
+	if s < len(m.raw) {
+		rawStart = m.raw[s]
+	}
+	if e == s {
+		return rawStart, rawStart
+	}
+	return rawStart, m.raw[e-1] + 1
+}
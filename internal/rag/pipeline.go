@@ -2,31 +2,151 @@ package rag
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"slices"
 	"strings"
+	"sync"
 
+	"ragbook/internal/analysis"
 	"ragbook/internal/embeddings"
+	"ragbook/internal/keyword"
 	"ragbook/internal/store"
 	"ragbook/internal/types"
 )
 
 type IngestConfig struct {
-	ChunkSize       int
-	ChunkOverlap    int
-	MaxChunks       int
-	NormalizeSpaces bool
+	ChunkSize       int  `json:"chunk_size"`
+	ChunkOverlap    int  `json:"chunk_overlap"`
+	MaxChunks       int  `json:"max_chunks,omitempty"`
+	NormalizeSpaces bool `json:"normalize_spaces"`
+	// Chunker selects the chunking strategy; empty means ChunkFixed.
+	Chunker ChunkStrategy `json:"chunker,omitempty"`
+	// StripBoilerplate removes Project Gutenberg headers, footers,
+	// transcriber notes and contents listings before chunking.
+	StripBoilerplate bool `json:"strip_boilerplate"`
+	// Metadata is attached to every chunk of the book and can be used in
+	// search filters.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// ErrBookExists is returned by IngestBook when the book ID is already indexed.
+var ErrBookExists = errors.New("book already exists")
+
+// ErrBookNotFound is returned by DeleteBook for unknown book IDs.
+var ErrBookNotFound = errors.New("book not found")
+
+// ErrInvalidConfig is returned by IngestBook and NewChunker for chunking
+// settings that cannot work, such as an overlap as large as the chunk size.
+var ErrInvalidConfig = errors.New("invalid ingest config")
+
+// BookInfo describes an indexed book. Config is known for books ingested by
+// this process or, with a store that keeps book metadata, loaded from it.
+type BookInfo struct {
+	BookID string        `json:"book_id"`
+	Chunks int           `json:"chunks"`
+	Config *IngestConfig `json:"ingest_config,omitempty"`
+}
+
+// IngestResult summarizes one IngestBook call.
+type IngestResult struct {
+	BookID   string      `json:"book_id"`
+	Chunks   int         `json:"chunks"`
+	Stripped StripReport `json:"stripped"`
 }
 
 type Pipeline struct {
-	store    store.VectorStore
-	embedder embeddings.Embedder
+	store     store.ContextVectorStore
+	embedder  embeddings.ContextEmbedder
+	keywords  *keyword.Index
+	generator Generator
+	reranker  Reranker           // for RerankCrossEncoder; see WithReranker
+	defaults  types.QueryRequest // see WithQueryDefaults
+	fitter    embeddings.Fitter  // nil unless the embedder learns corpus statistics
+	// storeSync and embedderSync flush a persistent store and a persistent
+	// embedder's fitted statistics after writes; nil if not persistent.
+	storeSync    store.Syncer
+	embedderSync store.Syncer
+	bookMeta     store.BookMetaStore // persists ingest configs; nil if unsupported
+
+	mu        sync.Mutex // serializes index writes; guards configs and ingesting
+	configs   map[string]IngestConfig
+	ingesting map[string]bool // book IDs reserved by an IngestBook in progress
+}
+
+// NewPipeline creates a pipeline over store. A BM25 index is kept alongside
+// the store; chunks already in a store that can list them are indexed now.
+// Stores and embedders without context support are adapted to check the
+// context between calls.
+func NewPipeline(vs store.VectorStore, embedder embeddings.Embedder, opts ...Option) *Pipeline {
+	p := &Pipeline{
+		store:     store.WithContext(vs),
+		embedder:  embeddings.WithContext(embedder),
+		keywords:  keyword.NewIndex(),
+		generator: ExtractiveGenerator{},
+		configs:   make(map[string]IngestConfig),
+		ingesting: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	// The context adapters hide optional interfaces, so look for them on
+	// the values passed in.
+	p.fitter, _ = embedder.(embeddings.Fitter)
+	p.storeSync, _ = vs.(store.Syncer)
+	p.embedderSync, _ = embedder.(store.Syncer)
+	p.bookMeta, _ = vs.(store.BookMetaStore)
+	if lister, ok := vs.(store.ChunkLister); ok {
+		for _, c := range lister.Chunks() {
+			p.keywords.Add(c)
+		}
+	}
+	p.loadConfigs()
+	return p
+}
+
+// loadConfigs reads the ingest configs of the stored books from a store
+// that keeps book metadata.
+func (p *Pipeline) loadConfigs() {
+	if p.bookMeta == nil {
+		return
+	}
+	books, err := p.store.ListBooks()
+	if err != nil {
+		log.Printf("loading ingest configs: %v", err)
+		return
+	}
+	for _, b := range books {
+		data, ok := p.bookMeta.BookMeta(b.BookID)
+		if !ok {
+			continue
+		}
+		var cfg IngestConfig
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			log.Printf("loading ingest config of book %s: %v", b.BookID, err)
+			continue
+		}
+		p.configs[b.BookID] = cfg
+	}
 }
 
-func NewPipeline(store store.VectorStore, embedder embeddings.Embedder) *Pipeline {
-	return &Pipeline{store: store, embedder: embedder}
+// WithKeywordAnalyzer sets the analyzer of the BM25 index. The default only
+// tokenizes; use the embedder's analyzer to keep both retrievers consistent.
+func WithKeywordAnalyzer(a analysis.Analyzer) Option {
+	return func(p *Pipeline) {
+		p.keywords = keyword.NewIndexWithAnalyzer(a)
+	}
 }
 
-func (p *Pipeline) IngestBook(ctx context.Context, bookID, text string, cfg IngestConfig) (int, error) {
+// IngestBook chunks, embeds and indexes a book. The book ID is reserved
+// while the book is chunked and embedded, which may take long with a remote
+// embedder, but the pipeline is only locked to add the chunks. If ingestion
+// fails, including when ctx is done before the book is fully indexed, the
+// chunks added so far and the book's fitted corpus statistics are removed
+// again so the book can be retried.
+func (p *Pipeline) IngestBook(ctx context.Context, bookID, text string, cfg IngestConfig) (res *IngestResult, err error) {
 	if cfg.ChunkSize <= 0 {
 		cfg.ChunkSize = 800
 	}
@@ -34,53 +154,243 @@ func (p *Pipeline) IngestBook(ctx context.Context, bookID, text string, cfg Inge
 		cfg.ChunkOverlap = 0
 	}
 
+	chunker, err := NewChunker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.reserve(bookID); err != nil {
+		return nil, err
+	}
+	var fitted []string // texts to unfit on rollback
+	defer func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.ingesting, bookID)
+		if err != nil {
+			res.Chunks = 0
+			p.rollback(bookID, fitted)
+		}
+	}()
+
+	res = &IngestResult{BookID: bookID}
+	input := text
+	var kept []int // input lines left after stripping; nil for all
+	if cfg.StripBoilerplate {
+		text, kept, res.Stripped = stripBoilerplate(text)
+	}
+
+	raw := text
 	if cfg.NormalizeSpaces {
-		text = normalizeSpaces(text)
+		if _, ok := chunker.(StructuredChunker); ok {
+			text = normalizeParagraphs(text)
+		} else {
+			text = normalizeSpaces(text)
+		}
 	}
+	headings := findHeadings(raw, text, cfg.NormalizeSpaces)
 
-	chunks := chunkText(text, cfg.ChunkSize, cfg.ChunkOverlap)
+	chunks := chunker.Chunk(text)
 	if cfg.MaxChunks > 0 && len(chunks) > cfg.MaxChunks {
 		chunks = chunks[:cfg.MaxChunks]
 	}
+	var offsets offsetMap
+	mapOffsets := false
+	if text != input {
+		offsets, mapOffsets = newOffsetMap(input, kept, text)
+	}
 
-	embs, err := p.embedder.Embed(chunks)
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Text
+	}
+	if p.fitter != nil {
+		if err := p.fitter.Fit(texts); err != nil {
+			return res, fmt.Errorf("fitting embedder: %w", err)
+		}
+		fitted = texts
+	}
+	embs, err := p.embedder.EmbedContext(ctx, texts)
 	if err != nil {
-		return 0, fmt.Errorf("embedding chunks: %w", err)
+		return res, fmt.Errorf("embedding chunks: %w", err)
 	}
 
-	for i, chunkText := range chunks {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, c := range chunks {
 		id := fmt.Sprintf("%s-%d", bookID, i)
 		chunk := types.DocumentChunk{
-			ID:        id,
-			BookID:    bookID,
-			Index:     i,
-			Text:      chunkText,
-			Embedding: embs[i],
+			ID:          id,
+			BookID:      bookID,
+			Index:       i,
+			Text:        c.Text,
+			StartOffset: c.Start,
+			EndOffset:   c.End,
+			Metadata:    cfg.Metadata,
+			Embedding:   embs[i],
+		}
+		if mapOffsets {
+			chunk.StartOffset, chunk.EndOffset = offsets.span(c.Start, c.End)
+		}
+		// Attribute the chunk to the heading in effect at its midpoint, so
+		// a chunk that straddles a chapter break goes to the chapter it
+		// mostly covers.
+		if h, ok := headingAt(headings, (c.Start+c.End)/2); ok {
+			chunk.Chapter = h.Chapter
+			chunk.ChapterTitle = h.Title
+			chunk.Section = h.Section
 		}
-		if err := p.store.AddChunk(chunk); err != nil {
-			return i, fmt.Errorf("adding chunk %d: %w", i, err)
+		if err := p.store.AddChunkContext(ctx, chunk); err != nil {
+			return res, fmt.Errorf("adding chunk %d: %w", i, err)
 		}
+		p.keywords.Add(chunk)
+	}
+	res.Chunks = len(chunks)
+	if p.bookMeta != nil {
+		data, err := json.Marshal(cfg)
+		if err != nil {
+			return res, fmt.Errorf("encode ingest config: %w", err)
+		}
+		if err := p.bookMeta.SetBookMeta(bookID, data); err != nil {
+			return res, err
+		}
+	}
+	if err := p.sync(); err != nil {
+		return res, err
 	}
-	return len(chunks), nil
+	p.configs[bookID] = cfg
+	return res, nil
 }
 
-func (p *Pipeline) AnswerQuery(ctx context.Context, req types.QueryRequest) (*types.QueryResponse, error) {
-	topK := req.TopK
-	if topK <= 0 {
-		topK = 5
+// ListBooks returns the indexed books ordered by ID.
+func (p *Pipeline) ListBooks() ([]BookInfo, error) {
+	stats, err := p.store.ListBooks()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	books := make([]BookInfo, len(stats))
+	for i, st := range stats {
+		books[i] = BookInfo{BookID: st.BookID, Chunks: st.Chunks}
+		if cfg, ok := p.configs[st.BookID]; ok {
+			books[i].Config = &cfg
+		}
 	}
+	return books, nil
+}
 
-	emb, err := p.embedder.EmbedQuery(req.Query)
+// DeleteBook removes a book from the vector store, the keyword index and the
+// embedder's corpus statistics and returns the number of chunks removed.
+func (p *Pipeline) DeleteBook(bookID string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Collect the texts the embedder was fitted on before they are gone.
+	var texts []string
+	if p.fitter != nil {
+		for i := 0; ; i++ {
+			c, ok := p.store.GetChunk(bookID, i)
+			if !ok {
+				break
+			}
+			texts = append(texts, c.Text)
+		}
+	}
+	n, err := p.store.DeleteBook(bookID)
 	if err != nil {
-		return nil, fmt.Errorf("embed query: %w", err)
+		return 0, err
 	}
+	if n == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrBookNotFound, bookID)
+	}
+	p.keywords.DeleteBook(bookID)
+	delete(p.configs, bookID)
+	if p.fitter != nil {
+		if err := p.fitter.Unfit(texts); err != nil {
+			return n, fmt.Errorf("unfitting embedder: %w", err)
+		}
+	}
+	return n, p.sync()
+}
 
-	sources, err := p.store.Search(emb, topK)
+// reserve claims bookID for an ingestion unless the book is already indexed
+// or being ingested.
+func (p *Pipeline) reserve(bookID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ingesting[bookID] {
+		return fmt.Errorf("%w: %s is being ingested", ErrBookExists, bookID)
+	}
+	if exists, err := p.hasBook(bookID); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%w: %s", ErrBookExists, bookID)
+	}
+	p.ingesting[bookID] = true
+	return nil
+}
+
+// rollback removes the chunks of a partially ingested book and the corpus
+// statistics fitted on texts. p.mu must be held. Only the store is synced: the embedder's
+// statistics are back to what was last saved, less any concurrent changes
+// the next successful write saves.
+func (p *Pipeline) rollback(bookID string, texts []string) {
+	if p.fitter != nil && texts != nil {
+		if err := p.fitter.Unfit(texts); err != nil {
+			log.Printf("rollback of book %s failed: %v", bookID, err)
+		}
+	}
+	if _, err := p.store.DeleteBook(bookID); err != nil {
+		log.Printf("rollback of book %s failed: %v", bookID, err)
+	}
+	p.keywords.DeleteBook(bookID)
+	if p.storeSync != nil {
+		if err := p.storeSync.Sync(); err != nil {
+			log.Printf("rollback of book %s failed: %v", bookID, err)
+		}
+	}
+}
+
+// sync flushes a persistent store, and a persistent embedder's fitted
+// statistics, after a write.
+func (p *Pipeline) sync() error {
+	for _, s := range []store.Syncer{p.storeSync, p.embedderSync} {
+		if s == nil {
+			continue
+		}
+		if err := s.Sync(); err != nil {
+			return fmt.Errorf("sync: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) hasBook(bookID string) (bool, error) {
+	books, err := p.store.ListBooks()
 	if err != nil {
-		return nil, fmt.Errorf("search: %w", err)
+		return false, err
+	}
+	for _, b := range books {
+		if b.BookID == bookID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *Pipeline) AnswerQuery(ctx context.Context, req types.QueryRequest) (*types.QueryResponse, error) {
+	sources, err := p.sources(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	answer := buildSimpleAnswer(req.Query, sources)
+	if len(sources) > 0 {
+		if answer, err = p.generator.Generate(ctx, req.Query, sources); err != nil {
+			return nil, fmt.Errorf("generate answer: %w", err)
+		}
+	}
 
 	resp := &types.QueryResponse{
 		Answer:  answer,
@@ -89,6 +399,141 @@ func (p *Pipeline) AnswerQuery(ctx context.Context, req types.QueryRequest) (*ty
 	return resp, nil
 }
 
+// QueryStream receives the parts of a streamed answer. Returning an error
+// from either callback stops the query with that error.
+type QueryStream struct {
+	Sources func([]types.SourceChunk) error
+	Delta   func(string) error
+}
+
+// AnswerQueryStream answers like AnswerQuery but delivers the sources as
+// soon as they are retrieved and the answer piece by piece as it is
+// generated. Generators that cannot stream deliver it in one piece.
+func (p *Pipeline) AnswerQueryStream(ctx context.Context, req types.QueryRequest, out QueryStream) error {
+	sources, err := p.sources(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := out.Sources(sources); err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return out.Delta(buildSimpleAnswer(req.Query, sources))
+	}
+	if err := streamAnswer(ctx, p.generator, req.Query, sources, out.Delta); err != nil {
+		return fmt.Errorf("generate answer: %w", err)
+	}
+	return nil
+}
+
+// sources retrieves the chunks answering req: candidates are retrieved with
+// MinScore applied to their vector similarity, reranked, diversified or cut
+// to TopK, and expanded.
+// Options left unset fall back to the pipeline's query defaults.
+func (p *Pipeline) sources(ctx context.Context, req types.QueryRequest) ([]types.SourceChunk, error) {
+	req = p.withDefaults(req)
+	if err := ValidateQuery(req); err != nil {
+		return nil, err
+	}
+	topK := 5
+	if req.TopK != nil && *req.TopK > 0 {
+		topK = *req.TopK
+	}
+	mode, _ := ParseRetrievalMode(req.RetrievalMode)
+	diversity, _ := ParseDiversity(req.Diversity)
+	kind, _ := ParseRerank(req.Rerank)
+	reranker, err := p.rerankerFor(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	fetch := topK
+	if reranker != nil {
+		depth := DefaultRerankDepth
+		if req.RerankDepth != nil {
+			depth = *req.RerankDepth
+		}
+		fetch = max(fetch, depth)
+	}
+	if diversity != DiversityNone {
+		fetch = max(fetch, topK*diversifyFetchFactor, minDiversifyFetch)
+	}
+	sources, err := p.retrieve(ctx, req.Query, fetch, mode, req.Filter, req.MinScore)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sources {
+		sources[i].RetrievalScore = sources[i].Score
+	}
+	if reranker != nil {
+		if sources, err = rerank(ctx, reranker, req.Query, sources); err != nil {
+			return nil, err
+		}
+	}
+	switch diversity {
+	case DiversityMMR:
+		// BM25 results carry no embeddings; MMR needs them to compare chunks.
+		for i := range sources {
+			if sources[i].Embedding == nil {
+				if c, ok := p.store.GetChunk(sources[i].BookID, sources[i].Index); ok {
+					sources[i].Embedding = c.Embedding
+				}
+			}
+		}
+		lambda := float32(DefaultMMRLambda)
+		if req.MMRLambda != nil {
+			lambda = *req.MMRLambda
+		}
+		sources = mmr(sources, topK, lambda)
+	case DiversityDedupe:
+		sources = dedupeOverlapping(sources, topK)
+	default:
+		if len(sources) > topK {
+			sources = sources[:topK]
+		}
+	}
+	if req.Expand != nil {
+		sources = expandSources(p.store, sources, *req.Expand)
+	}
+	return sources, nil
+}
+
+// retrieve returns the topK chunks passing filter for query using the given
+// mode.
+func (p *Pipeline) retrieve(ctx context.Context, query string, topK int, mode RetrievalMode, filter *types.SearchFilter, minScore *float32) ([]types.SourceChunk, error) {
+	if mode == RetrievalKeyword {
+		return p.keywords.Search(query, topK, filter), nil
+	}
+
+	fetch := topK
+	if mode != RetrievalVector {
+		fetch = max(topK*hybridFetchFactor, minHybridFetch)
+	}
+	emb, err := p.embedder.EmbedQueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	vector, err := p.store.SearchContext(ctx, emb, store.SearchOptions{TopK: fetch, Filter: filter})
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+	// The threshold is on vector similarity, whose scale does not depend on
+	// the mode; fused scores and BM25 scores have scales of their own.
+	if minScore != nil {
+		threshold := *minScore
+		vector = slices.DeleteFunc(vector, func(s types.SourceChunk) bool { return s.Score < threshold })
+	}
+
+	switch mode {
+	case RetrievalHybrid:
+		return fuseRRF(topK, vector, p.keywords.Search(query, fetch, filter)), nil
+	case RetrievalHybridWeighted:
+		return fuseWeighted(topK, hybridVectorWeight, vector, p.keywords.Search(query, fetch, filter)), nil
+	default:
+		return vector, nil
+	}
+}
+
 func buildSimpleAnswer(query string, sources []types.SourceChunk) string {
 	if len(sources) == 0 {
 		return "No relevant passages found for your query."
@@ -97,35 +542,53 @@ func buildSimpleAnswer(query string, sources []types.SourceChunk) string {
 	b.WriteString("Answer based on the book:\n\n")
 	b.WriteString("Query: " + query + "\n\n")
 	for i, s := range sources {
-		fmt.Fprintf(&b, "Excerpt %d (chunk %d, score=%.3f):\n%s\n\n", i+1, s.Index, s.Score, s.Text)
+		if cite := citation(s); cite != "" {
+			fmt.Fprintf(&b, "Excerpt %d (%s, chunk %d, score=%.3f):\n%s\n\n", i+1, cite, s.Index, s.Score, s.Text)
+		} else {
+			fmt.Fprintf(&b, "Excerpt %d (chunk %d, score=%.3f):\n%s\n\n", i+1, s.Index, s.Score, s.Text)
+		}
 	}
 	b.WriteString("Note: These excerpts were retrieved from the source text.\n")
 	return b.String()
 }
 
-func chunkText(text string, size, overlap int) []string {
+// citation names the part of the book a source comes from, e.g.
+// "Chapter VII: A Mad Tea-Party". It is empty when no heading was detected.
+func citation(s types.SourceChunk) string {
+	var parts []string
+	if s.Section != "" {
+		parts = append(parts, s.Section)
+	}
+	switch {
+	case s.Chapter > 0 && s.ChapterTitle != "":
+		parts = append(parts, fmt.Sprintf("Chapter %s: %s", toRoman(s.Chapter), s.ChapterTitle))
+	case s.Chapter > 0:
+		parts = append(parts, "Chapter "+toRoman(s.Chapter))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func chunkText(text string, size, overlap int) []TextChunk {
+	runes := []rune(text)
+	n := len(runes)
 	if size <= 0 {
-		return []string{text}
+		return []TextChunk{{Text: text, Start: 0, End: n}}
 	}
 	if overlap < 0 {
 		overlap = 0
 	}
-	var chunks []string
-	runes := []rune(text)
-	n := len(runes)
+	var chunks []TextChunk
 	for start := 0; start < n; {
 		end := start + size
 		if end > n {
 			end = n
 		}
-		chunks = append(chunks, string(runes[start:end]))
+		chunks = append(chunks, TextChunk{Text: string(runes[start:end]), Start: start, End: end})
 		if end == n {
 			break
 		}
-		start = end - overlap
-		if start < 0 {
-			start = 0
-		}
+		// Always move forward, even if overlap >= size slipped through.
+		start = max(end-overlap, start+1)
 	}
 	return chunks
 }
@@ -0,0 +1,238 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"ragbook/internal/embeddings"
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+// failingStore fails the failAt-th chunk added.
+type failingStore struct {
+	*store.MemoryStore
+	failAt, added int
+}
+
+func (s *failingStore) AddChunkContext(ctx context.Context, c types.DocumentChunk) error {
+	if s.added++; s.added == s.failAt {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.AddChunkContext(ctx, c)
+}
+
+func TestIngestBookRollsBackOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tfidf.json")
+	emb, err := embeddings.OpenTFIDFEmbedder(path, embeddings.HashOptions{Dim: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := &failingStore{MemoryStore: store.NewMemoryStore(), failAt: 3}
+	p := NewPipeline(vs, emb)
+	text := strings.Repeat("The Queen shouted off with her head. ", 100)
+	cfg := IngestConfig{ChunkSize: 100}
+
+	if _, err := p.IngestBook(context.Background(), "alice", text, cfg); err == nil {
+		t.Fatal("IngestBook succeeded with a failing store")
+	}
+	if n := vs.Count(); n != 0 {
+		t.Errorf("store kept %d chunks of the failed book", n)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("rollback saved the failed book's TF-IDF statistics")
+	}
+	got, _ := emb.EmbedQuery("queen head")
+	want, _ := embeddings.NewTFIDFEmbedderWithOptions(embeddings.HashOptions{Dim: 64}).EmbedQuery("queen head")
+	if !slices.Equal(got, want) {
+		t.Error("rollback kept the failed book's TF-IDF statistics")
+	}
+
+	vs.failAt = 0
+	res, err := p.IngestBook(context.Background(), "alice", text, cfg)
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if res.Chunks == 0 || vs.Count() != res.Chunks {
+		t.Errorf("retry indexed %d chunks, store has %d", res.Chunks, vs.Count())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.IngestBook(ctx, "sherlock", text, cfg); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled ingest: got %v", err)
+	}
+	if vs.Count() != res.Chunks {
+		t.Errorf("cancelled ingest left chunks: store has %d, want %d", vs.Count(), res.Chunks)
+	}
+}
+
+// blockingEmbedder waits for release before embedding chunks.
+type blockingEmbedder struct {
+	*embeddings.HashEmbedder
+	started, release chan struct{}
+}
+
+func (e blockingEmbedder) Embed(texts []string) ([][]float32, error) {
+	close(e.started)
+	<-e.release
+	return e.HashEmbedder.Embed(texts)
+}
+
+func TestIngestBookDoesNotLockWhileEmbedding(t *testing.T) {
+	emb := blockingEmbedder{embeddings.NewHashEmbedder(64), make(chan struct{}), make(chan struct{})}
+	p := NewPipeline(store.NewMemoryStore(), emb)
+	done := make(chan error)
+	go func() {
+		_, err := p.IngestBook(context.Background(), "alice", "Down the rabbit hole.", IngestConfig{})
+		done <- err
+	}()
+	<-emb.started
+
+	if _, err := p.ListBooks(); err != nil {
+		t.Fatalf("ListBooks during ingestion: %v", err)
+	}
+	if _, err := p.DeleteBook("alice"); !errors.Is(err, ErrBookNotFound) {
+		t.Errorf("DeleteBook during ingestion: got %v, want ErrBookNotFound", err)
+	}
+	if _, err := p.IngestBook(context.Background(), "alice", "Again.", IngestConfig{}); !errors.Is(err, ErrBookExists) {
+		t.Errorf("second IngestBook of the same ID: got %v, want ErrBookExists", err)
+	}
+
+	close(emb.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	books, _ := p.ListBooks()
+	if len(books) != 1 || books[0].BookID != "alice" || books[0].Config == nil {
+		t.Errorf("books after ingestion = %+v", books)
+	}
+}
+
+func TestIngestConfigSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	emb := embeddings.NewHashEmbedder(64)
+	meta := store.IndexMeta{Embedder: emb.Name(), Dimension: emb.Dimension()}
+	vs, err := store.OpenDiskStore(dir, meta, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := IngestConfig{ChunkSize: 120, ChunkOverlap: 20, Chunker: ChunkStructured, Metadata: map[string]string{"author": "Carroll"}}
+	if _, err := NewPipeline(vs, emb).IngestBook(context.Background(), "alice", strings.Repeat("Off with her head! ", 30), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := vs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	vs, err = store.OpenDiskStore(dir, meta, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vs.Close()
+	books, err := NewPipeline(vs, emb).ListBooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 1 || books[0].Config == nil {
+		t.Fatalf("books after reopen = %+v, want alice with its config", books)
+	}
+	if got := *books[0].Config; got.ChunkSize != cfg.ChunkSize || got.Chunker != cfg.Chunker || got.Metadata["author"] != "Carroll" {
+		t.Errorf("config after reopen = %+v, want %+v", got, cfg)
+	}
+}
+
+func TestQueryTopKZeroAndMinScore(t *testing.T) {
+	topK := 2
+	p := NewPipeline(store.NewMemoryStore(), embeddings.NewHashEmbedder(64), WithQueryDefaults(types.QueryRequest{TopK: &topK}))
+	text := "The Queen of Hearts made some tarts.\n\nThe Knave of Hearts stole those tarts.\n\n" +
+		"The King called for the cook.\n\nThe Hatter sang about a tea tray."
+	if _, err := p.IngestBook(context.Background(), "alice", text, IngestConfig{ChunkSize: 40, Chunker: ChunkStructured}); err != nil {
+		t.Fatal(err)
+	}
+	query := func(req types.QueryRequest) []types.SourceChunk {
+		t.Helper()
+		req.Query = "tarts"
+		resp, err := p.AnswerQuery(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%+v: %v", req, err)
+		}
+		return resp.Sources
+	}
+
+	zero := 0
+	if got := query(types.QueryRequest{TopK: &zero}); len(got) != topK {
+		t.Errorf("top_k 0 returned %d sources, want the default %d", len(got), topK)
+	}
+
+	// No chunk is that similar to the query, so vector candidates are all
+	// dropped; BM25 scores are on another scale and are not filtered.
+	high := float32(0.99)
+	if got := query(types.QueryRequest{MinScore: &high}); len(got) != 0 {
+		t.Errorf("vector mode kept %d sources below min_score", len(got))
+	}
+	for _, mode := range []string{"keyword", "hybrid", "hybrid_weighted"} {
+		got := query(types.QueryRequest{RetrievalMode: mode, MinScore: &high})
+		if len(got) == 0 || !strings.Contains(got[0].Text, "tarts") {
+			t.Errorf("%s mode with min_score returned %+v, want the keyword hits", mode, got)
+		}
+	}
+}
+
+func TestChunkOffsetsPointIntoInputText(t *testing.T) {
+	text := "*** START OF THE PROJECT GUTENBERG EBOOK ALICE ***\r\n\r\n" +
+		"CHAPTER I.\r\nDown the  Rabbit-Hole\r\n\r\n" +
+		"Alice was beginning to get very tired of sitting\r\nby her sister on the bank.   " +
+		"She had nothing to do.\r\n\r\n\r\n" +
+		"Once or twice she had peeped into the\r\nbook her sister was reading.\r\n\r\n" +
+		"*** END OF THE PROJECT GUTENBERG EBOOK ALICE ***\r\n"
+	runes := []rune(text)
+	label := "She had nothing to do."
+	start := len([]rune(text[:strings.Index(text, label)]))
+	end := start + len([]rune(label))
+
+	for _, chunker := range []ChunkStrategy{ChunkFixed, ChunkStructured} {
+		p := NewPipeline(store.NewMemoryStore(), embeddings.NewHashEmbedder(64))
+		cfg := IngestConfig{ChunkSize: 60, ChunkOverlap: 10, Chunker: chunker, NormalizeSpaces: true, StripBoilerplate: true}
+		if _, err := p.IngestBook(context.Background(), "alice", text, cfg); err != nil {
+			t.Fatal(err)
+		}
+		matched := false
+		for _, c := range p.store.(*store.MemoryStore).Chunks() {
+			// Each span holds the chunk text, give or take whitespace.
+			if got := normalizeSpaces(string(runes[c.StartOffset:c.EndOffset])); got != normalizeSpaces(c.Text) {
+				t.Errorf("%s: chunk %d spans %q, want %q", chunker, c.Index, got, c.Text)
+			}
+			if c.StartOffset <= start && end <= c.EndOffset {
+				matched = true
+			}
+		}
+		if !matched {
+			t.Errorf("%s: no chunk contains the label [%d, %d)", chunker, start, end)
+		}
+	}
+}
+
+func TestDeleteBookUnfitsEmbedder(t *testing.T) {
+	emb := embeddings.NewTFIDFEmbedderWithOptions(embeddings.HashOptions{Dim: 64})
+	p := NewPipeline(store.NewMemoryStore(), emb)
+	cfg := IngestConfig{ChunkSize: 100}
+	if _, err := p.IngestBook(context.Background(), "alice", strings.Repeat("The Queen shouted off with her head. ", 20), cfg); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := emb.EmbedQuery("queen head")
+	if _, err := p.IngestBook(context.Background(), "bob", strings.Repeat("The Queen played croquet with flamingos. ", 20), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.DeleteBook("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := emb.EmbedQuery("queen head"); !slices.Equal(got, want) {
+		t.Error("deleted book's counts still weigh query terms")
+	}
+}
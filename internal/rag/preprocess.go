@@ -0,0 +1,142 @@
+package rag
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// StripReport describes the boilerplate removed from a book before chunking.
+type StripReport struct {
+	Header           bool `json:"header"`
+	HeaderChars      int  `json:"header_chars"`
+	Footer           bool `json:"footer"`
+	FooterChars      int  `json:"footer_chars"`
+	TranscriberNotes int  `json:"transcriber_notes"`
+	ContentsLines    int  `json:"contents_lines"`
+}
+
+var (
+	gutenbergStart = regexp.MustCompile(`(?i)^\*{3}\s*start of (the|this) project gutenberg`)
+	gutenbergEnd   = regexp.MustCompile(`(?i)^(\*{3}\s*end of (the|this) project gutenberg|end of (the )?project gutenberg)`)
+	transcriberRe  = regexp.MustCompile(`(?i)^\[?\s*transcriber(['’]s|s['’])?\s+notes?\b`)
+	contentsRe     = regexp.MustCompile(`(?i)^(table of )?contents[.:]?$`)
+)
+
+// maxContentsLines bounds how far a contents listing is allowed to run.
+const maxContentsLines = 300
+
+// StripBoilerplate removes the Project Gutenberg license header and footer,
+// transcriber notes and the table of contents from a book, returning the
+// remaining text and a report of what was removed.
+func StripBoilerplate(text string) (string, StripReport) {
+	stripped, _, rep := stripBoilerplate(text)
+	return stripped, rep
+}
+
+// stripBoilerplate is StripBoilerplate also returning the indexes of the
+// lines of text it kept.
+func stripBoilerplate(text string) (string, []int, StripReport) {
+	var rep StripReport
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	first := 0 // index in text of lines[0]
+	for i, line := range lines {
+		if gutenbergStart.MatchString(strings.TrimSpace(line)) {
+			rep.Header = true
+			rep.HeaderChars = runeLen(lines[:i+1])
+			lines, first = lines[i+1:], i+1
+			break
+		}
+	}
+	for i, line := range lines {
+		if gutenbergEnd.MatchString(strings.TrimSpace(line)) {
+			rep.Footer = true
+			rep.FooterChars = runeLen(lines[i:])
+			lines = lines[:i]
+			break
+		}
+	}
+
+	kept := make([]int, 0, len(lines))
+	out := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case transcriberRe.MatchString(trimmed):
+			i = skipTranscriberNote(lines, i)
+			rep.TranscriberNotes++
+		case contentsRe.MatchString(trimmed) && i < len(lines)/5:
+			end, ok := contentsEnd(lines, i+1)
+			if !ok {
+				kept = append(kept, first+i)
+				out = append(out, lines[i])
+				continue
+			}
+			rep.ContentsLines += end - i
+			i = end - 1
+		default:
+			kept = append(kept, first+i)
+			out = append(out, lines[i])
+		}
+	}
+	return strings.Join(out, "\n"), kept, rep
+}
+
+// skipTranscriberNote returns the index of the last line of the note starting
+// at lines[i]. Bracketed notes run to the closing bracket, others to the end
+// of the paragraph.
+func skipTranscriberNote(lines []string, i int) int {
+	bracketed := strings.HasPrefix(strings.TrimSpace(lines[i]), "[")
+	for j := i; j < len(lines); j++ {
+		if bracketed && strings.Contains(lines[j], "]") {
+			return j
+		}
+		if !bracketed && j+1 < len(lines) && strings.TrimSpace(lines[j+1]) == "" {
+			return j
+		}
+	}
+	return len(lines) - 1
+}
+
+// contentsEnd returns the index of the first line after the contents listing
+// that starts at lines[start]. The listing ends at the first heading that
+// repeats its first entry (e.g. "CHAPTER I." after " CHAPTER I. Down the
+// Rabbit-Hole"), at a run of three blank lines, or at an overlong line. It
+// reports false if no such end is found, in which case the "Contents" line is
+// probably not a listing at all.
+func contentsEnd(lines []string, start int) (int, bool) {
+	first := ""
+	blanks := 0
+	for j := start; j < len(lines) && j < start+maxContentsLines; j++ {
+		norm := strings.ToLower(normalizeSpaces(lines[j]))
+		if norm == "" {
+			blanks++
+			if first != "" && blanks >= 3 {
+				return j + 1, true
+			}
+			continue
+		}
+		blanks = 0
+		if first == "" {
+			first = norm
+			continue
+		}
+		if strings.HasPrefix(first, norm) || utf8.RuneCountInString(norm) > 80 {
+			// Back up over the blank lines preceding the heading or prose.
+			for j > start && strings.TrimSpace(lines[j-1]) == "" {
+				j--
+			}
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+func runeLen(lines []string) int {
+	n := 0
+	for _, l := range lines {
+		n += utf8.RuneCountInString(l) + 1
+	}
+	return n
+}
@@ -0,0 +1,57 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripBoilerplateMarkers(t *testing.T) {
+	const (
+		header = "The Project Gutenberg eBook of Alice\r\nRelease date: 1991\r\n" +
+			"*** START OF THE PROJECT GUTENBERG EBOOK ALICE'S ADVENTURES IN WONDERLAND ***\r\n"
+		body   = "CHAPTER I.\r\nDown the Rabbit-Hole\r\n\r\nAlice was beginning to get very tired.\r\n"
+		footer = "*** END OF THE PROJECT GUTENBERG EBOOK ALICE'S ADVENTURES IN WONDERLAND ***\r\n" +
+			"Updated editions will replace the previous one.\r\n"
+	)
+	tests := []struct {
+		name                 string
+		text                 string
+		wantHeader, wantFoot bool
+		dropped              []string
+		kept                 []string
+	}{
+		{"both markers", header + body + footer, true, true, []string{"Release date", "Updated editions"}, []string{"CHAPTER I."}},
+		{"no start marker", body + footer, false, true, []string{"Updated editions"}, []string{"CHAPTER I."}},
+		{"no end marker", header + body, true, false, []string{"Release date"}, []string{"very tired"}},
+		{"no markers", body, false, false, nil, []string{"CHAPTER I.", "very tired"}},
+		{
+			// Older books end with a bare "End of Project Gutenberg's …" line.
+			name:       "old style end marker",
+			text:       header + body + "End of Project Gutenberg's Alice's Adventures in Wonderland\r\nLicense text.\r\n",
+			wantHeader: true, wantFoot: true,
+			dropped: []string{"License text"},
+			kept:    []string{"very tired"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rep := StripBoilerplate(tt.text)
+			if rep.Header != tt.wantHeader || rep.Footer != tt.wantFoot {
+				t.Errorf("report = %+v, want header %v footer %v", rep, tt.wantHeader, tt.wantFoot)
+			}
+			for _, s := range tt.dropped {
+				if strings.Contains(got, s) {
+					t.Errorf("kept %q", s)
+				}
+			}
+			for _, s := range tt.kept {
+				if !strings.Contains(got, s) {
+					t.Errorf("dropped %q", s)
+				}
+			}
+			if strings.Contains(got, "\r") || strings.Contains(got, "***") {
+				t.Errorf("stripped text %q still has CRs or a marker", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"ragbook/internal/types"
+)
+
+// DefaultSystemPrompt instructs the model to answer only from the excerpts.
+const DefaultSystemPrompt = `You answer questions about a book using only the numbered excerpts you are given.
+Cite the excerpts you rely on inline as [1], [2], and so on.
+If the excerpts do not contain the answer, say that you cannot tell from the book.`
+
+// DefaultUserPrompt lists the excerpts with their citation numbers, then the
+// question.
+const DefaultUserPrompt = `Excerpts:
+{{range .Sources}}
+[{{.N}}]{{if .Citation}} ({{.Citation}}){{end}}
+{{.Text}}
+{{end}}
+Question: {{.Query}}`
+
+// Prompt renders the chat messages sent to a language model.
+type Prompt struct {
+	System string
+	User   *template.Template
+}
+
+// PromptSource is one excerpt as seen by the user prompt template.
+type PromptSource struct {
+	types.SourceChunk
+	N        int // 1-based citation number
+	Citation string
+}
+
+// PromptData is the data passed to the user prompt template.
+type PromptData struct {
+	Query   string
+	Sources []PromptSource
+}
+
+// DefaultPrompt returns the built-in prompt.
+func DefaultPrompt() *Prompt {
+	p, err := ParsePrompt(DefaultSystemPrompt, DefaultUserPrompt)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// ParsePrompt builds a Prompt from a system message and a text/template for
+// the user message, which is executed with PromptData.
+func ParsePrompt(system, user string) (*Prompt, error) {
+	t, err := template.New("user").Parse(user)
+	if err != nil {
+		return nil, fmt.Errorf("parse prompt template: %w", err)
+	}
+	return &Prompt{System: system, User: t}, nil
+}
+
+// Render returns the system and user messages for query and sources.
+func (p *Prompt) Render(query string, sources []types.SourceChunk) (system, user string, err error) {
+	data := PromptData{Query: query, Sources: make([]PromptSource, len(sources))}
+	for i, s := range sources {
+		data.Sources[i] = PromptSource{SourceChunk: s, N: i + 1, Citation: citation(s)}
+	}
+	var b strings.Builder
+	if err := p.User.Execute(&b, data); err != nil {
+		return "", "", fmt.Errorf("render prompt: %w", err)
+	}
+	return p.System, b.String(), nil
+}
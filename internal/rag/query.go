@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"ragbook/internal/types"
+)
+
+// MaxTopK bounds QueryRequest.TopK.
+const MaxTopK = 100
+
+// ErrInvalidQuery is wrapped by the errors ValidateQuery returns.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ValidateQuery checks the retrieval options of req. The query text itself
+// is not checked, so the function also validates server defaults.
+func ValidateQuery(req types.QueryRequest) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidQuery, fmt.Sprintf(format, args...))
+	}
+	if k := req.TopK; k != nil && (*k < 0 || *k > MaxTopK) {
+		return invalid("top_k must be between 1 and %d, or 0 for the default", MaxTopK)
+	}
+	if _, err := ParseRetrievalMode(req.RetrievalMode); err != nil {
+		return invalid("%v", err)
+	}
+	if s := req.MinScore; s != nil && (math.IsNaN(float64(*s)) || math.IsInf(float64(*s), 0)) {
+		return invalid("min_score must be a finite number")
+	}
+	if _, err := ParseDiversity(req.Diversity); err != nil {
+		return invalid("%v", err)
+	}
+	if l := req.MMRLambda; l != nil && !(*l >= 0 && *l <= 1) {
+		return invalid("mmr_lambda must be between 0 and 1")
+	}
+	if n := req.Expand; n != nil && (*n < 0 || *n > MaxExpand) {
+		return invalid("expand must be between 0 and %d", MaxExpand)
+	}
+	if _, err := ParseRerank(req.Rerank); err != nil {
+		return invalid("%v", err)
+	}
+	if d := req.RerankDepth; d != nil && (*d < 1 || *d > MaxRerankDepth) {
+		return invalid("rerank_depth must be between 1 and %d", MaxRerankDepth)
+	}
+	if f := req.Filter; f != nil && (f.ChapterFrom < 0 || f.ChapterTo < 0 ||
+		(f.ChapterTo > 0 && f.ChapterFrom > f.ChapterTo)) {
+		return invalid("invalid chapter range in filter")
+	}
+	return nil
+}
+
+// WithQueryDefaults sets the retrieval options used when a request leaves
+// them unset (nil or empty): TopK, RetrievalMode, MinScore, Diversity, MMRLambda, Expand,
+// Rerank and RerankDepth. Query and Filter are ignored.
+func WithQueryDefaults(def types.QueryRequest) Option {
+	return func(p *Pipeline) {
+		p.defaults = def
+	}
+}
+
+// withDefaults fills the unset retrieval options of req from the
+// pipeline's defaults.
+func (p *Pipeline) withDefaults(req types.QueryRequest) types.QueryRequest {
+	def := p.defaults
+	// No query wants zero chunks, so top_k 0 means the default, as it did
+	// before the option became a pointer.
+	if req.TopK == nil || *req.TopK == 0 {
+		req.TopK = def.TopK
+	}
+	if req.RetrievalMode == "" {
+		req.RetrievalMode = def.RetrievalMode
+	}
+	if req.MinScore == nil {
+		req.MinScore = def.MinScore
+	}
+	if req.Diversity == "" {
+		req.Diversity = def.Diversity
+	}
+	if req.MMRLambda == nil {
+		req.MMRLambda = def.MMRLambda
+	}
+	if req.Expand == nil {
+		req.Expand = def.Expand
+	}
+	if req.Rerank == "" {
+		req.Rerank = def.Rerank
+	}
+	if req.RerankDepth == nil {
+		req.RerankDepth = def.RerankDepth
+	}
+	return req
+}
@@ -0,0 +1,211 @@
+package rag
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"ragbook/internal/analysis"
+	"ragbook/internal/keyword"
+	"ragbook/internal/types"
+)
+
+// Reranker scores retrieved candidates against the query, typically with a
+// model too costly to run over the whole corpus.
+type Reranker interface {
+	// Rerank returns one score per candidate, in candidate order; higher
+	// is more relevant.
+	Rerank(ctx context.Context, query string, candidates []types.SourceChunk) ([]float32, error)
+}
+
+// Rerank selects the reranker AnswerQuery applies to the retrieved
+// candidates.
+type Rerank string
+
+const (
+	// RerankNone keeps the retrieval order.
+	RerankNone Rerank = "none"
+	// RerankProximity scores how many query terms a chunk contains and how
+	// close together and in query order they appear; see ProximityReranker.
+	RerankProximity Rerank = "proximity"
+	// RerankBM25 rescores the candidates with BM25 over the keyword index,
+	// e.g. to re-order vector results by exact term matches.
+	RerankBM25 Rerank = "bm25"
+	// RerankCrossEncoder uses the reranker set with WithReranker, such as
+	// an HTTPReranker.
+	RerankCrossEncoder Rerank = "cross_encoder"
+)
+
+const (
+	// DefaultRerankDepth is how many candidates are retrieved for reranking
+	// when a request sets no depth.
+	DefaultRerankDepth = 50
+	// MaxRerankDepth bounds QueryRequest.RerankDepth.
+	MaxRerankDepth = 200
+)
+
+// ParseRerank resolves a reranker name; the empty string means none.
+func ParseRerank(name string) (Rerank, error) {
+	switch r := Rerank(strings.ToLower(strings.TrimSpace(name))); r {
+	case "", RerankNone:
+		return RerankNone, nil
+	case RerankProximity, RerankBM25, RerankCrossEncoder:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unknown reranker %q", name)
+	}
+}
+
+// WithReranker sets the reranker used for RerankCrossEncoder requests.
+func WithReranker(r Reranker) Option {
+	return func(p *Pipeline) {
+		p.reranker = r
+	}
+}
+
+// rerankerFor returns the reranker of kind, or nil for RerankNone.
+func (p *Pipeline) rerankerFor(kind Rerank) (Reranker, error) {
+	switch kind {
+	case RerankProximity:
+		return ProximityReranker{Analyzer: p.keywords.Analyzer()}, nil
+	case RerankBM25:
+		return BM25Reranker{Index: p.keywords}, nil
+	case RerankCrossEncoder:
+		if p.reranker == nil {
+			return nil, fmt.Errorf("%w: no cross-encoder reranker is configured", ErrInvalidQuery)
+		}
+		return p.reranker, nil
+	default:
+		return nil, nil
+	}
+}
+
+// rerank scores candidates with r and sorts them best first. Each keeps its
+// retrieval score in RetrievalScore; Score and RerankScore become the
+// rerank score. Ties keep the retrieval order.
+func rerank(ctx context.Context, r Reranker, query string, candidates []types.SourceChunk) ([]types.SourceChunk, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+	scores, err := r.Rerank(ctx, query, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("rerank: %w", err)
+	}
+	if len(scores) != len(candidates) {
+		return nil, fmt.Errorf("rerank: got %d scores for %d candidates", len(scores), len(candidates))
+	}
+	for i := range candidates {
+		score := scores[i]
+		candidates[i].Score = score
+		candidates[i].RerankScore = &score
+	}
+	slices.SortStableFunc(candidates, func(a, b types.SourceChunk) int {
+		return cmp.Compare(*b.RerankScore, *a.RerankScore)
+	})
+	return candidates, nil
+}
+
+// Weights of the ProximityReranker signals; they sum to 1.
+const (
+	proximityCoverageWeight = 0.5
+	proximityWindowWeight   = 0.3
+	proximityPhraseWeight   = 0.2
+)
+
+// ProximityReranker scores a chunk in [0, 1] from three signals over the
+// analyzed query and chunk terms: the fraction of distinct query terms the
+// chunk contains, how tightly the contained terms cluster (terms found
+// divided by the smallest span of tokens holding them all) and the fraction
+// of adjacent query term pairs that also appear adjacent, in order, in the
+// chunk.
+type ProximityReranker struct {
+	Analyzer analysis.Analyzer
+}
+
+func (r ProximityReranker) Rerank(ctx context.Context, query string, candidates []types.SourceChunk) ([]float32, error) {
+	terms := r.Analyzer.Analyze(query)
+	scores := make([]float32, len(candidates))
+	if len(terms) == 0 {
+		return scores, nil
+	}
+	for i, c := range candidates {
+		scores[i] = proximityScore(terms, r.Analyzer.Analyze(c.Text))
+	}
+	return scores, nil
+}
+
+func proximityScore(query, tokens []string) float32 {
+	ids := make(map[string]int) // distinct query term -> id
+	for _, t := range query {
+		if _, ok := ids[t]; !ok {
+			ids[t] = len(ids)
+		}
+	}
+
+	// Occurrences of query terms in token order.
+	type hit struct{ pos, term int }
+	var hits []hit
+	found := make(map[int]bool)
+	for pos, t := range tokens {
+		if id, ok := ids[t]; ok {
+			hits = append(hits, hit{pos, id})
+			found[id] = true
+		}
+	}
+	if len(found) == 0 {
+		return 0
+	}
+	coverage := float32(len(found)) / float32(len(ids))
+
+	// Smallest window holding every term found, by sliding over the hits.
+	window := len(tokens)
+	inWindow := make(map[int]int)
+	for lo, hi := 0, 0; hi < len(hits); hi++ {
+		inWindow[hits[hi].term]++
+		for len(inWindow) == len(found) {
+			window = min(window, hits[hi].pos-hits[lo].pos+1)
+			if inWindow[hits[lo].term]--; inWindow[hits[lo].term] == 0 {
+				delete(inWindow, hits[lo].term)
+			}
+			lo++
+		}
+	}
+	proximity := float32(len(found)) / float32(window)
+
+	phrase := coverage
+	if len(query) > 1 {
+		adjacent := make(map[[2]string]bool)
+		for i := 1; i < len(tokens); i++ {
+			adjacent[[2]string{tokens[i-1], tokens[i]}] = true
+		}
+		n := 0
+		for i := 1; i < len(query); i++ {
+			if adjacent[[2]string{query[i-1], query[i]}] {
+				n++
+			}
+		}
+		phrase = float32(n) / float32(len(query)-1)
+	}
+
+	return proximityCoverageWeight*coverage + proximityWindowWeight*proximity + proximityPhraseWeight*phrase
+}
+
+// BM25Reranker scores candidates with BM25, using the term statistics of
+// Index so that scores are comparable with keyword retrieval.
+type BM25Reranker struct {
+	Index *keyword.Index
+}
+
+func (r BM25Reranker) Rerank(ctx context.Context, query string, candidates []types.SourceChunk) ([]float32, error) {
+	texts := make([]string, len(candidates))
+	for i, c := range candidates {
+		texts[i] = c.Text
+	}
+	scores := make([]float32, len(candidates))
+	for i, s := range r.Index.Score(query, texts) {
+		scores[i] = float32(s)
+	}
+	return scores, nil
+}
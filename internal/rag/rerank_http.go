@@ -0,0 +1,73 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ragbook/internal/httpclient"
+	"ragbook/internal/types"
+)
+
+// HTTPReranker scores candidates with a cross-encoder served behind a
+// Cohere or Jina style /rerank endpoint.
+type HTTPReranker struct {
+	BaseURL    string // API root, e.g. https://api.jina.ai/v1; required
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client // defaults to http.DefaultClient
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float32 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, candidates []types.SourceChunk) ([]float32, error) {
+	if r.BaseURL == "" {
+		return nil, errors.New("rerank base URL is not set")
+	}
+	req := rerankRequest{
+		Model:     r.Model,
+		Query:     query,
+		Documents: make([]string, len(candidates)),
+		TopN:      len(candidates),
+	}
+	for i, c := range candidates {
+		req.Documents[i] = c.Text
+	}
+	var resp rerankResponse
+	if err := httpclient.PostJSON(ctx, r.HTTPClient, r.url(), httpclient.BearerHeader(r.APIKey), req, &resp); err != nil {
+		return nil, err
+	}
+
+	scores := make([]float32, len(candidates))
+	scored := make([]bool, len(candidates))
+	for _, res := range resp.Results {
+		if res.Index < 0 || res.Index >= len(candidates) {
+			return nil, fmt.Errorf("rerank result index %d out of range", res.Index)
+		}
+		scores[res.Index], scored[res.Index] = res.RelevanceScore, true
+	}
+	for i, ok := range scored {
+		if !ok {
+			return nil, fmt.Errorf("rerank response has no score for document %d", i)
+		}
+	}
+	return scores, nil
+}
+
+func (r *HTTPReranker) url() string {
+	return strings.TrimRight(r.BaseURL, "/") + "/rerank"
+}
@@ -0,0 +1,90 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ragbook/internal/embeddings"
+	"ragbook/internal/store"
+	"ragbook/internal/types"
+)
+
+// rerankServer is a cross-encoder that likes tarts, and thieves even more.
+func rerankServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/rerank" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("request to %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req rerankRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		if req.Model != "m" || req.TopN != len(req.Documents) {
+			t.Errorf("request = %+v", req)
+		}
+		// Results come back best first, not in document order.
+		var results []string
+		for i := len(req.Documents) - 1; i >= 0; i-- {
+			score := 0.0
+			if strings.Contains(req.Documents[i], "tarts") {
+				score += 0.5
+			}
+			if strings.Contains(req.Documents[i], "stole") {
+				score += 0.25
+			}
+			results = append(results, fmt.Sprintf(`{"index":%d,"relevance_score":%g}`, i, score))
+		}
+		fmt.Fprintf(w, `{"results":[%s]}`, strings.Join(results, ","))
+	}))
+}
+
+func TestHTTPRerankerOrdersByScore(t *testing.T) {
+	srv := rerankServer(t)
+	defer srv.Close()
+
+	emb := embeddings.NewHashEmbedder(64)
+	p := NewPipeline(store.NewMemoryStore(), emb, WithReranker(&HTTPReranker{BaseURL: srv.URL + "/v1", APIKey: "secret", Model: "m"}))
+	text := "The Queen of Hearts, she made some tarts.\n\nThe Knave of Hearts, he stole those tarts.\n\n" +
+		"The King called for the cook.\n\nThe Hatter sang a song about a tea tray."
+	if _, err := p.IngestBook(context.Background(), "alice", text, IngestConfig{ChunkSize: 50, Chunker: ChunkStructured}); err != nil {
+		t.Fatal(err)
+	}
+	topK := 2
+	resp, err := p.AnswerQuery(context.Background(), types.QueryRequest{Query: "who took the tarts", TopK: &topK, Rerank: "cross_encoder"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sources) != 2 {
+		t.Fatalf("got %d sources, want 2", len(resp.Sources))
+	}
+	for i, s := range resp.Sources {
+		if !strings.Contains(s.Text, "tarts") || s.RerankScore == nil || s.Score != *s.RerankScore {
+			t.Errorf("source %d = %q score %v rerank %v", i, s.Text, s.Score, s.RerankScore)
+		}
+	}
+	if !strings.Contains(resp.Sources[0].Text, "stole") || resp.Sources[0].Score != 0.75 || resp.Sources[1].Score != 0.5 {
+		t.Errorf("sources not ordered by rerank score: %q (%v) then %q (%v)",
+			resp.Sources[0].Text, resp.Sources[0].Score, resp.Sources[1].Text, resp.Sources[1].Score)
+	}
+}
+
+func TestHTTPRerankerRejectsIncompleteResponse(t *testing.T) {
+	for _, body := range []string{
+		`{"results":[{"index":0,"relevance_score":0.5}]}`,
+		`{"results":[{"index":0,"relevance_score":0.5},{"index":2,"relevance_score":0.1}]}`,
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		}))
+		r := &HTTPReranker{BaseURL: srv.URL}
+		if _, err := r.Rerank(context.Background(), "q", make([]types.SourceChunk, 2)); err == nil {
+			t.Errorf("accepted response %s for 2 documents", body)
+		}
+		srv.Close()
+	}
+}
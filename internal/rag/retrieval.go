@@ -0,0 +1,118 @@
+package rag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"ragbook/internal/types"
+)
+
+// RetrievalMode selects how AnswerQuery finds candidate chunks.
+type RetrievalMode string
+
+const (
+	// RetrievalVector ranks chunks by embedding similarity only.
+	RetrievalVector RetrievalMode = "vector"
+	// RetrievalKeyword ranks chunks by BM25 only.
+	RetrievalKeyword RetrievalMode = "keyword"
+	// RetrievalHybrid fuses vector and BM25 rankings with reciprocal rank
+	// fusion.
+	RetrievalHybrid RetrievalMode = "hybrid"
+	// RetrievalHybridWeighted fuses min-max normalized vector and BM25 scores
+	// with a fixed weight.
+	RetrievalHybridWeighted RetrievalMode = "hybrid_weighted"
+)
+
+const (
+	// rrfK dampens the contribution of top ranks in reciprocal rank fusion.
+	rrfK = 60
+	// hybridVectorWeight is the weight of the vector score in weighted fusion;
+	// BM25 gets the remainder.
+	hybridVectorWeight = 0.5
+	// hybridFetchFactor is how many candidates per requested result each
+	// retriever contributes to fusion.
+	hybridFetchFactor = 4
+	minHybridFetch    = 20
+)
+
+// ParseRetrievalMode resolves a mode name; the empty string means vector.
+func ParseRetrievalMode(name string) (RetrievalMode, error) {
+	switch m := RetrievalMode(strings.ToLower(strings.TrimSpace(name))); m {
+	case "", RetrievalVector:
+		return RetrievalVector, nil
+	case RetrievalKeyword, RetrievalHybrid, RetrievalHybridWeighted:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown retrieval mode %q", name)
+	}
+}
+
+// fuseRRF merges ranked lists by summing 1/(rrfK+rank) per chunk.
+func fuseRRF(topK int, lists ...[]types.SourceChunk) []types.SourceChunk {
+	scores := make(map[string]float32)
+	chunks := make(map[string]types.SourceChunk)
+	for _, list := range lists {
+		for rank, s := range list {
+			scores[s.ID] += 1 / float32(rrfK+rank+1)
+			if _, ok := chunks[s.ID]; !ok {
+				chunks[s.ID] = s
+			}
+		}
+	}
+	return rankFused(scores, chunks, topK)
+}
+
+// fuseWeighted merges a vector and a keyword ranking by a weighted sum of
+// their min-max normalized scores. A chunk missing from one list gets 0 for
+// that list.
+func fuseWeighted(topK int, vectorWeight float32, vector, keyword []types.SourceChunk) []types.SourceChunk {
+	scores := make(map[string]float32)
+	chunks := make(map[string]types.SourceChunk)
+	add := func(list []types.SourceChunk, weight float32) {
+		lo, hi := scoreRange(list)
+		for _, s := range list {
+			norm := float32(1)
+			if hi > lo {
+				norm = (s.Score - lo) / (hi - lo)
+			}
+			scores[s.ID] += weight * norm
+			if _, ok := chunks[s.ID]; !ok {
+				chunks[s.ID] = s
+			}
+		}
+	}
+	add(vector, vectorWeight)
+	add(keyword, 1-vectorWeight)
+	return rankFused(scores, chunks, topK)
+}
+
+func rankFused(scores map[string]float32, chunks map[string]types.SourceChunk, topK int) []types.SourceChunk {
+	out := make([]types.SourceChunk, 0, len(chunks))
+	for id, s := range chunks {
+		s.Score = scores[id]
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].ID < out[j].ID
+	})
+	if len(out) > topK {
+		out = out[:topK]
+	}
+	return out
+}
+
+func scoreRange(list []types.SourceChunk) (lo, hi float32) {
+	for i, s := range list {
+		if i == 0 || s.Score < lo {
+			lo = s.Score
+		}
+		if i == 0 || s.Score > hi {
+			hi = s.Score
+		}
+	}
+	return lo, hi
+}
@@ -0,0 +1,46 @@
+package rag
+
+import (
+	"slices"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+func ranked(ids ...string) []types.SourceChunk {
+	out := make([]types.SourceChunk, len(ids))
+	for i, id := range ids {
+		out[i] = types.SourceChunk{ID: id, Score: float32(len(ids) - i)}
+	}
+	return out
+}
+
+func TestFuseRRF(t *testing.T) {
+	vector, keyword := ranked("a", "b", "c"), ranked("c", "d")
+	// c is in both lists, so it beats a, first in only one; b and d, both
+	// second once, tie and are ordered by ID.
+	got := fuseRRF(10, vector, keyword)
+	if want := []string{"c", "a", "b", "d"}; !slices.Equal(ids(got), want) {
+		t.Fatalf("fuseRRF = %v, want %v", ids(got), want)
+	}
+	if want := 1/float32(63) + 1/float32(61); got[0].Score != want {
+		t.Errorf("fused score of c = %v, want %v", got[0].Score, want)
+	}
+	if got := fuseRRF(2, vector, keyword); !slices.Equal(ids(got), []string{"c", "a"}) {
+		t.Errorf("fuseRRF(topK=2) = %v, want [c a]", ids(got))
+	}
+}
+
+func TestFuseWeighted(t *testing.T) {
+	vector, keyword := ranked("a", "b", "c"), ranked("c", "d")
+	// After min-max normalization a scores 1 as a vector hit and c 1 as a
+	// keyword hit but 0 as a vector one, so at equal weights they tie at
+	// 0.5 and are ordered by ID.
+	got := fuseWeighted(10, 0.5, vector, keyword)
+	if want := []string{"a", "c", "b", "d"}; !slices.Equal(ids(got), want) {
+		t.Errorf("fuseWeighted = %v, want %v", ids(got), want)
+	}
+	if got := fuseWeighted(10, 0.9, vector, keyword); ids(got)[0] != "a" || ids(got)[1] != "b" {
+		t.Errorf("fuseWeighted favoring vectors = %v, want a and b first", ids(got))
+	}
+}
@@ -0,0 +1,274 @@
+package rag
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Heading is a chapter or section heading found in a book.
+type Heading struct {
+	// Offset is the rune offset of the heading in the ingested text.
+	Offset  int
+	Chapter int
+	Title   string
+	// Section is the enclosing book/part/volume heading, e.g. "BOOK TWO".
+	Section string
+}
+
+var (
+	chapterRe = regexp.MustCompile(`^(?:CHAPTER|Chapter)\s+([IVXLCDM]+|\d+|[A-Za-z]+(?:-[A-Za-z]+)?)\b\.?\s*(?:[:.\-—–]\s*)?(.*)$`)
+	sectionRe = regexp.MustCompile(`^(BOOK|PART|VOLUME|Book|Part|Volume)\s+([IVXLCDM]+|\d+|[A-Za-z]+(?:-[A-Za-z]+)?)\b\.?\s*(?:[:.\-—–]\s*)?(.*)$`)
+	romanRe   = regexp.MustCompile(`^([IVXLC]+)\.(?:\s+(.+))?$`)
+)
+
+// maxHeadingLen is the longest line considered as a heading or heading title.
+const maxHeadingLen = 80
+
+// findHeadings detects chapter and section headings in raw, which must still
+// have its line breaks, and positions them in final. final is raw after
+// optional whitespace normalization; normalized says whether it was applied.
+//
+// Normalization only changes whitespace, so a heading line is positioned by
+// counting the non-space runes before it in raw and skipping as many in
+// final. This places it at the start of its own line rather than at the
+// first match of its text, which for a numeral like "I." may lie inside an
+// earlier heading.
+func findHeadings(raw, final string, normalized bool) []Heading {
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	blank := func(i int) bool { return i < 0 || i >= len(lines) || strings.TrimSpace(lines[i]) == "" }
+
+	var headings []Heading
+	section := ""
+	chapterStyle := false // a "CHAPTER N" heading was seen
+	rawText := 0          // non-space runes in the lines before the current one
+	cursor, runeCursor, finalText := 0, 0, 0
+	locate := func(line string) (int, bool) {
+		for cursor < len(final) {
+			r, size := utf8.DecodeRuneInString(final[cursor:])
+			if finalText == rawText && !unicode.IsSpace(r) {
+				break
+			}
+			if !unicode.IsSpace(r) {
+				finalText++
+			}
+			cursor += size
+			runeCursor++
+		}
+		key := strings.TrimSpace(line)
+		if normalized {
+			key = normalizeSpaces(key)
+		}
+		if !strings.HasPrefix(final[cursor:], key) {
+			return 0, false
+		}
+		return runeCursor, true
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if i > 0 {
+			rawText += nonSpaceRunes(lines[i-1])
+		}
+		if trimmed == "" || utf8.RuneCountInString(trimmed) > maxHeadingLen || !blank(i-1) {
+			continue
+		}
+
+		var h Heading
+		switch {
+		case sectionRe.MatchString(trimmed):
+			m := sectionRe.FindStringSubmatch(trimmed)
+			if _, ok := parseOrdinal(m[2]); !ok {
+				continue
+			}
+			section = m[1] + " " + m[2]
+			if title := headingTitle(m[3], lines, i); title != "" {
+				section += ": " + title
+			}
+		case chapterRe.MatchString(trimmed):
+			m := chapterRe.FindStringSubmatch(trimmed)
+			n, ok := parseOrdinal(m[1])
+			if !ok {
+				continue
+			}
+			h = Heading{Chapter: n, Title: headingTitle(m[2], lines, i)}
+			chapterStyle = true
+		case romanRe.MatchString(trimmed) && !chapterStyle:
+			// A bare numeral is a heading only when set apart: an inline
+			// title and a blank line after, or a title line or blank line
+			// after the numeral alone.
+			m := romanRe.FindStringSubmatch(trimmed)
+			n, ok := parseRoman(m[1])
+			if !ok {
+				continue
+			}
+			if m[2] != "" && (!isTitleLike(m[2]) || !blank(i+1)) {
+				continue
+			}
+			if m[2] == "" && !blank(i+1) && headingTitle("", lines, i) == "" {
+				continue
+			}
+			h = Heading{Chapter: n, Title: headingTitle(m[2], lines, i)}
+		default:
+			continue
+		}
+
+		offset, ok := locate(line)
+		if !ok {
+			continue
+		}
+		h.Offset = offset
+		h.Section = section
+		headings = append(headings, h)
+	}
+	return headings
+}
+
+func nonSpaceRunes(s string) int {
+	n := 0
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// headingTitle returns the title on the heading line itself, or else the
+// next line when it is a short line of its own, as in
+//
+//	CHAPTER I.
+//	Down the Rabbit-Hole
+func headingTitle(rest string, lines []string, i int) string {
+	if rest = strings.TrimSpace(rest); rest != "" {
+		return rest
+	}
+	if i+1 >= len(lines) {
+		return ""
+	}
+	next := strings.TrimSpace(lines[i+1])
+	if next == "" || utf8.RuneCountInString(next) > maxHeadingLen {
+		return ""
+	}
+	if i+2 < len(lines) && strings.TrimSpace(lines[i+2]) != "" {
+		return ""
+	}
+	return next
+}
+
+// headingAt returns the heading in effect at rune offset pos, if any.
+func headingAt(headings []Heading, pos int) (Heading, bool) {
+	var h Heading
+	found := false
+	for _, c := range headings {
+		if c.Offset > pos {
+			break
+		}
+		h, found = c, true
+	}
+	return h, found
+}
+
+// isTitleLike reports whether s looks like a title rather than prose, i.e.
+// most of its words are capitalized.
+func isTitleLike(s string) bool {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return false
+	}
+	upper := 0
+	for _, w := range words {
+		r, _ := utf8.DecodeRuneInString(w)
+		if unicode.IsUpper(r) || !unicode.IsLetter(r) {
+			upper++
+		}
+	}
+	return upper*2 > len(words)
+}
+
+var numberWords = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7,
+	"eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+	"thirteen": 13, "fourteen": 14, "fifteen": 15, "sixteen": 16,
+	"seventeen": 17, "eighteen": 18, "nineteen": 19, "twenty": 20,
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "sixth": 6,
+	"seventh": 7, "eighth": 8, "ninth": 9, "tenth": 10,
+}
+
+var tensWords = map[string]int{
+	"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50, "sixty": 60,
+	"seventy": 70, "eighty": 80, "ninety": 90,
+}
+
+// parseOrdinal parses a chapter or section number written as digits, a
+// roman numeral or an English number word ("TWO", "Twenty-One").
+func parseOrdinal(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, n > 0
+	}
+	if n, ok := parseRoman(s); ok {
+		return n, true
+	}
+	lower := strings.ToLower(s)
+	if n, ok := numberWords[lower]; ok {
+		return n, true
+	}
+	if tens, unit, ok := strings.Cut(lower, "-"); ok {
+		t, ok1 := tensWords[tens]
+		u, ok2 := numberWords[unit]
+		if ok1 && ok2 && u < 10 {
+			return t + u, true
+		}
+	}
+	return 0, false
+}
+
+var romanValues = map[rune]int{'I': 1, 'V': 5, 'X': 10, 'L': 50, 'C': 100, 'D': 500, 'M': 1000}
+
+// parseRoman parses an upper-case roman numeral.
+func parseRoman(s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	total, prev := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		v, ok := romanValues[rune(s[i])]
+		if !ok {
+			return 0, false
+		}
+		if v < prev {
+			total -= v
+		} else {
+			total += v
+			prev = v
+		}
+	}
+	if toRoman(total) != s {
+		return 0, false
+	}
+	return total, true
+}
+
+// toRoman formats n as an upper-case roman numeral.
+func toRoman(n int) string {
+	if n <= 0 {
+		return strconv.Itoa(n)
+	}
+	numerals := []struct {
+		v int
+		s string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+		{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+	var b strings.Builder
+	for _, r := range numerals {
+		for n >= r.v {
+			b.WriteString(r.s)
+			n -= r.v
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package rag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindHeadings(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want []Heading // Offset is checked via prefix below
+		at   []string  // text each heading must start with in final
+	}{
+		{
+			name: "chapter style ignores later bare numerals",
+			raw: "CHAPTER I.\nDown the Rabbit-Hole\n\nAlice was beginning to get very tired.\n\n" +
+				"CHAPTER II.\nThe Pool of Tears\n\nCuriouser and curiouser!\n\nI.\n\nShe went on.\n",
+			want: []Heading{{Chapter: 1, Title: "Down the Rabbit-Hole"}, {Chapter: 2, Title: "The Pool of Tears"}},
+			at:   []string{"CHAPTER I.", "CHAPTER II."},
+		},
+		{
+			name: "bare numerals with title line or blank lines",
+			raw:  "I.\nA SCANDAL IN BOHEMIA\n\nTo Sherlock Holmes she is always the woman.\n\nII.\n\nAt three o'clock precisely.\n",
+			want: []Heading{{Chapter: 1, Title: "A SCANDAL IN BOHEMIA"}, {Chapter: 2}},
+			at:   []string{"I.", "II."},
+		},
+		{
+			name: "bare numeral running into prose",
+			raw:  "Intro text.\n\nI.\nwent to the market and\nbought some bread.\n",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		for _, normalized := range []bool{false, true} {
+			final := tt.raw
+			if normalized {
+				final = normalizeSpaces(tt.raw)
+			}
+			got := findHeadings(tt.raw, final, normalized)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%s (normalized=%v): got %d headings %+v, want %d", tt.name, normalized, len(got), got, len(tt.want))
+			}
+			runes := []rune(final)
+			for i, h := range got {
+				if h.Chapter != tt.want[i].Chapter || h.Title != tt.want[i].Title {
+					t.Errorf("%s (normalized=%v): heading %d = %d %q, want %d %q", tt.name, normalized, i,
+						h.Chapter, h.Title, tt.want[i].Chapter, tt.want[i].Title)
+				}
+				if rest := string(runes[h.Offset:]); !strings.HasPrefix(rest, tt.at[i]) {
+					t.Errorf("%s (normalized=%v): heading %d at offset %d starts %q, want %q", tt.name, normalized, i,
+						h.Offset, rest[:min(len(rest), 20)], tt.at[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+
+	"ragbook/internal/types"
+)
+
+// ContextVectorStore is a VectorStore whose writes and searches stop when a
+// context is done.
+type ContextVectorStore interface {
+	VectorStore
+	AddChunkContext(ctx context.Context, chunk types.DocumentChunk) error
+	SearchContext(ctx context.Context, queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error)
+}
+
+// WithContext returns vs itself if it is a ContextVectorStore. Otherwise it
+// wraps vs so that the context is checked before each call.
+func WithContext(vs VectorStore) ContextVectorStore {
+	if cs, ok := vs.(ContextVectorStore); ok {
+		return cs
+	}
+	return contextAdapter{vs}
+}
+
+type contextAdapter struct {
+	VectorStore
+}
+
+func (a contextAdapter) AddChunkContext(ctx context.Context, chunk types.DocumentChunk) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.AddChunk(chunk)
+}
+
+func (a contextAdapter) SearchContext(ctx context.Context, queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Search(queryEmbedding, opts)
+}
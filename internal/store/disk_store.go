@@ -0,0 +1,479 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"ragbook/internal/types"
+)
+
+// On-disk index layout (all integers little-endian):
+//
+//	header: magic "RBVX" | version uint16 | dimension uint32 | name length uint16 | embedder name
+//	record: kind uint8 | payload length uint32 | CRC-32 of payload uint32 | payload
+//
+// A chunk record's payload is the chunk metadata as JSON, prefixed by its
+// uint32 length, followed by dimension float32 values. A delete record's
+// payload is a book ID whose earlier chunks and metadata are dropped on load.
+// A book metadata record's payload is the book ID, prefixed by its uint16
+// length, followed by the metadata; the last one of a book wins. Records are
+// only ever appended, so adding or deleting never rewrites the file.
+//
+// A book metadata record also commits the chunks of its book written before
+// it. Chunks of a book without a later metadata record, as left by a crash
+// partway through an ingestion, are dropped on load, and a delete record is
+// appended for them.
+//
+// Version 2 added book metadata records and version 3 made them commit
+// records. An older index is upgraded by committing every book it holds with
+// an empty metadata record and rewriting the version in its header.
+const (
+	indexFileName = "index.rbx"
+	indexMagic    = "RBVX"
+	indexVersion  = 3
+
+	recordChunk      byte = 1
+	recordDeleteBook byte = 2
+	recordBookMeta   byte = 3
+)
+
+var (
+	// ErrIncompatibleIndex is returned when an existing index was built with a
+	// different embedder, dimension or format version.
+	ErrIncompatibleIndex = errors.New("incompatible index")
+	// ErrCorruptIndex is returned when an index file fails validation.
+	ErrCorruptIndex = errors.New("corrupt index")
+)
+
+// IndexMeta is recorded in the index header.
+type IndexMeta struct {
+	Embedder  string
+	Dimension int
+}
+
+// SearchIndex is an in-memory store a DiskStore can serve searches from.
+type SearchIndex interface {
+	VectorStore
+	ChunkLister
+}
+
+// DiskStore is a VectorStore that serves searches from memory and appends
+// every added chunk to an index file, so the index survives restarts. The
+// chunks of a book survive a restart once SetBookMeta has been called for
+// it after they were added.
+type DiskStore struct {
+	mem  SearchIndex
+	meta IndexMeta
+
+	mu       sync.Mutex // guards f, w and bookMeta
+	f        *os.File
+	w        *bufio.Writer
+	bookMeta map[string][]byte
+	dropped  []string
+}
+
+// OpenDiskStore opens the index in dir, creating the directory and an empty
+// index if needed. An existing index is loaded into memory and must match
+// meta. score ranks search results; nil means cosine similarity.
+func OpenDiskStore(dir string, meta IndexMeta, score Scorer) (*DiskStore, error) {
+	return OpenDiskStoreWithIndex(dir, meta, NewMemoryStoreWithScorer(score))
+}
+
+// OpenDiskStoreWithIndex is OpenDiskStore serving searches from index, which
+// must be empty, e.g. an approximate HNSWStore instead of an exact scan.
+func OpenDiskStoreWithIndex(dir string, meta IndexMeta, index SearchIndex) (*DiskStore, error) {
+	if meta.Dimension <= 0 {
+		return nil, fmt.Errorf("invalid index dimension %d", meta.Dimension)
+	}
+	if n := index.Count(); n > 0 {
+		return nil, fmt.Errorf("search index already holds %d chunks", n)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create index dir: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, indexFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open index: %w", err)
+	}
+
+	s := &DiskStore{mem: index, meta: meta, f: f, bookMeta: make(map[string][]byte)}
+	uncommitted, version, err := s.load()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.w = bufio.NewWriter(f)
+	if err := s.recover(uncommitted, version); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// recover commits the uncommitted books of an index older than version 3,
+// which had no commit records, and drops them from a newer one. It then
+// marks the file as the current version.
+func (s *DiskStore) recover(uncommitted []string, version int) error {
+	for _, bookID := range uncommitted {
+		if version < 3 {
+			if err := s.SetBookMeta(bookID, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := s.mem.DeleteBook(bookID); err != nil {
+			return err
+		}
+		if err := writeRecord(s.w, recordDeleteBook, []byte(bookID)); err != nil {
+			return fmt.Errorf("drop uncommitted book: %w", err)
+		}
+		s.dropped = append(s.dropped, bookID)
+	}
+	if err := s.Sync(); err != nil {
+		return err
+	}
+	if version < indexVersion {
+		// Mark the file so older builds refuse it once it holds newer
+		// records.
+		if _, err := s.f.WriteAt(binary.LittleEndian.AppendUint16(nil, indexVersion), 4); err != nil {
+			return fmt.Errorf("upgrade index: %w", err)
+		}
+	}
+	return nil
+}
+
+// DroppedBooks returns the books whose chunks were dropped when the index
+// was opened because they were never committed, e.g. because the process
+// was killed while ingesting them.
+func (s *DiskStore) DroppedBooks() []string {
+	return s.dropped
+}
+
+// Meta returns the index header.
+func (s *DiskStore) Meta() IndexMeta {
+	return s.meta
+}
+
+// AddChunkContext appends chunk unless ctx is already done.
+func (s *DiskStore) AddChunkContext(ctx context.Context, chunk types.DocumentChunk) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.AddChunk(chunk)
+}
+
+func (s *DiskStore) AddChunk(chunk types.DocumentChunk) error {
+	if len(chunk.Embedding) != s.meta.Dimension {
+		return fmt.Errorf("chunk embedding has dimension %d, index expects %d", len(chunk.Embedding), s.meta.Dimension)
+	}
+	payload, err := encodeChunk(chunk)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeRecord(s.w, recordChunk, payload); err != nil {
+		return fmt.Errorf("append chunk: %w", err)
+	}
+	return s.mem.AddChunk(chunk)
+}
+
+func (s *DiskStore) Search(queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error) {
+	return s.mem.Search(queryEmbedding, opts)
+}
+
+// SearchContext is Search, abandoning the scan once ctx is done.
+func (s *DiskStore) SearchContext(ctx context.Context, queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error) {
+	return WithContext(s.mem).SearchContext(ctx, queryEmbedding, opts)
+}
+
+func (s *DiskStore) GetChunk(bookID string, index int) (types.DocumentChunk, bool) {
+	return s.mem.GetChunk(bookID, index)
+}
+
+// Chunks returns a copy of all stored chunks in insertion order.
+func (s *DiskStore) Chunks() []types.DocumentChunk {
+	return s.mem.Chunks()
+}
+
+func (s *DiskStore) Count() int {
+	return s.mem.Count()
+}
+
+func (s *DiskStore) DeleteBook(bookID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bookMeta[bookID]; !ok && !s.hasChunks(bookID) {
+		return 0, nil
+	}
+	if err := writeRecord(s.w, recordDeleteBook, []byte(bookID)); err != nil {
+		return 0, fmt.Errorf("append delete: %w", err)
+	}
+	delete(s.bookMeta, bookID)
+	return s.mem.DeleteBook(bookID)
+}
+
+// hasChunks reports whether any chunk of bookID is stored.
+func (s *DiskStore) hasChunks(bookID string) bool {
+	books, _ := s.mem.ListBooks()
+	for _, b := range books {
+		if b.BookID == bookID {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBookMeta appends the metadata of a book, replacing any earlier one, and
+// commits the book's chunks added so far. Empty metadata only commits them.
+func (s *DiskStore) SetBookMeta(bookID string, meta []byte) error {
+	if len(bookID) > math.MaxUint16 {
+		return fmt.Errorf("book ID is %d bytes long", len(bookID))
+	}
+	payload := binary.LittleEndian.AppendUint16(nil, uint16(len(bookID)))
+	payload = append(payload, bookID...)
+	payload = append(payload, meta...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeRecord(s.w, recordBookMeta, payload); err != nil {
+		return fmt.Errorf("append book metadata: %w", err)
+	}
+	s.setMeta(bookID, meta)
+	return nil
+}
+
+func (s *DiskStore) setMeta(bookID string, meta []byte) {
+	if len(meta) == 0 {
+		delete(s.bookMeta, bookID)
+		return
+	}
+	s.bookMeta[bookID] = append([]byte(nil), meta...)
+}
+
+// BookMeta returns the metadata last set for a book.
+func (s *DiskStore) BookMeta(bookID string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, ok := s.bookMeta[bookID]
+	return meta, ok
+}
+
+func (s *DiskStore) ListBooks() ([]BookStats, error) {
+	return s.mem.ListBooks()
+}
+
+// Sync flushes buffered records and commits the file to stable storage.
+func (s *DiskStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close syncs and closes the index file.
+func (s *DiskStore) Close() error {
+	err := s.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// load reads the header and all records, or writes a fresh header if the
+// file is empty. A truncated trailing record, as left by a crash mid-append,
+// is discarded. It returns the books with chunks not followed by a commit,
+// sorted, and the format version of the file.
+func (s *DiskStore) load() ([]string, int, error) {
+	info, err := s.f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() == 0 {
+		return nil, indexVersion, s.writeHeader()
+	}
+
+	r := bufio.NewReader(s.f)
+	n, version, err := s.readHeader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset := int64(n)
+	uncommitted := make(map[string]bool)
+	for {
+		kind, payload, n, err := readRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			if err := s.f.Truncate(offset); err != nil {
+				return nil, 0, fmt.Errorf("truncate torn record: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += int64(n)
+
+		switch kind {
+		case recordChunk:
+			chunk, err := decodeChunk(payload, s.meta.Dimension)
+			if err != nil {
+				return nil, 0, err
+			}
+			if err := s.mem.AddChunk(chunk); err != nil {
+				return nil, 0, err
+			}
+			uncommitted[chunk.BookID] = true
+		case recordDeleteBook:
+			if _, err := s.mem.DeleteBook(string(payload)); err != nil {
+				return nil, 0, err
+			}
+			delete(s.bookMeta, string(payload))
+			delete(uncommitted, string(payload))
+		case recordBookMeta:
+			var n int
+			if len(payload) >= 2 {
+				n = 2 + int(binary.LittleEndian.Uint16(payload))
+			}
+			if n == 0 || len(payload) < n {
+				return nil, 0, fmt.Errorf("%w: short book metadata record", ErrCorruptIndex)
+			}
+			s.setMeta(string(payload[2:n]), payload[n:])
+			delete(uncommitted, string(payload[2:n]))
+		default:
+			return nil, 0, fmt.Errorf("%w: unknown record kind %d", ErrCorruptIndex, kind)
+		}
+	}
+	if _, err := s.f.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	return slices.Sorted(maps.Keys(uncommitted)), version, nil
+}
+
+func (s *DiskStore) writeHeader() error {
+	name := []byte(s.meta.Embedder)
+	buf := make([]byte, 0, 12+len(name))
+	buf = append(buf, indexMagic...)
+	buf = binary.LittleEndian.AppendUint16(buf, indexVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(s.meta.Dimension))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(name)))
+	buf = append(buf, name...)
+	_, err := s.f.Write(buf)
+	return err
+}
+
+// readHeader validates the header against s.meta and returns its size and
+// format version.
+func (s *DiskStore) readHeader(r io.Reader) (int, int, error) {
+	var fixed [12]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return 0, 0, fmt.Errorf("%w: short header", ErrCorruptIndex)
+	}
+	if string(fixed[:4]) != indexMagic {
+		return 0, 0, fmt.Errorf("%w: bad magic", ErrCorruptIndex)
+	}
+	version := int(binary.LittleEndian.Uint16(fixed[4:6]))
+	dim := int(binary.LittleEndian.Uint32(fixed[6:10]))
+	name := make([]byte, binary.LittleEndian.Uint16(fixed[10:12]))
+	if _, err := io.ReadFull(r, name); err != nil {
+		return 0, 0, fmt.Errorf("%w: short header", ErrCorruptIndex)
+	}
+
+	if version < 1 || version > indexVersion {
+		return 0, 0, fmt.Errorf("%w: format version %d, want %d", ErrIncompatibleIndex, version, indexVersion)
+	}
+	if string(name) != s.meta.Embedder || dim != s.meta.Dimension {
+		return 0, 0, fmt.Errorf("%w: built with %s/%d, want %s/%d",
+			ErrIncompatibleIndex, name, dim, s.meta.Embedder, s.meta.Dimension)
+	}
+	return len(fixed) + len(name), version, nil
+}
+
+func writeRecord(w io.Writer, kind byte, payload []byte) error {
+	var hdr [9]byte
+	hdr[0] = kind
+	binary.LittleEndian.PutUint32(hdr[1:5], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(hdr[5:9], crc32.ChecksumIEEE(payload))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// readRecord returns io.EOF at a clean end of file and io.ErrUnexpectedEOF
+// for a truncated record. remaining is the number of bytes left in the file;
+// a record claiming to be longer is truncated, and is rejected before its
+// payload is allocated.
+func readRecord(r io.Reader, remaining int64) (byte, []byte, int, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, 0, err
+	}
+	size := int64(binary.LittleEndian.Uint32(hdr[1:5]))
+	if size > remaining-int64(len(hdr)) {
+		return 0, nil, 0, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(hdr[5:9]) {
+		return 0, nil, 0, fmt.Errorf("%w: checksum mismatch", ErrCorruptIndex)
+	}
+	return hdr[0], payload, len(hdr) + len(payload), nil
+}
+
+func encodeChunk(chunk types.DocumentChunk) ([]byte, error) {
+	meta, err := json.Marshal(chunk)
+	if err != nil {
+		return nil, fmt.Errorf("encode chunk: %w", err)
+	}
+	buf := make([]byte, 0, 4+len(meta)+4*len(chunk.Embedding))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(meta)))
+	buf = append(buf, meta...)
+	for _, v := range chunk.Embedding {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+	}
+	return buf, nil
+}
+
+func decodeChunk(payload []byte, dim int) (types.DocumentChunk, error) {
+	var chunk types.DocumentChunk
+	if len(payload) < 4 {
+		return chunk, fmt.Errorf("%w: short chunk record", ErrCorruptIndex)
+	}
+	metaLen := int(binary.LittleEndian.Uint32(payload))
+	if len(payload) != 4+metaLen+4*dim {
+		return chunk, fmt.Errorf("%w: chunk record has %d bytes", ErrCorruptIndex, len(payload))
+	}
+	if err := json.Unmarshal(payload[4:4+metaLen], &chunk); err != nil {
+		return chunk, fmt.Errorf("%w: %v", ErrCorruptIndex, err)
+	}
+	vec := payload[4+metaLen:]
+	chunk.Embedding = make([]float32, dim)
+	for i := range chunk.Embedding {
+		chunk.Embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(vec[4*i:]))
+	}
+	return chunk, nil
+}
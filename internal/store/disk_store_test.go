@@ -0,0 +1,304 @@
+package store
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+func testChunks(book string, n, dim int) []types.DocumentChunk {
+	rng := rand.New(rand.NewSource(int64(len(book))))
+	chunks := make([]types.DocumentChunk, n)
+	for i := range chunks {
+		chunks[i] = types.DocumentChunk{
+			ID:          book + "-" + string(rune('a'+i)),
+			BookID:      book,
+			Index:       i,
+			Text:        "chunk text",
+			Chapter:     i/2 + 1,
+			StartOffset: 10 * i,
+			EndOffset:   10*i + 10,
+			Metadata:    map[string]string{"author": "Carroll"},
+			Embedding:   randomVector(rng, dim),
+		}
+	}
+	return chunks
+}
+
+func openTestStore(t *testing.T, dir string, meta IndexMeta) *DiskStore {
+	t.Helper()
+	s, err := OpenDiskStore(dir, meta, nil)
+	if err != nil {
+		t.Fatalf("OpenDiskStore: %v", err)
+	}
+	return s
+}
+
+// addBook adds the chunks of one book and commits them.
+func addBook(t *testing.T, s *DiskStore, chunks []types.DocumentChunk) {
+	t.Helper()
+	for _, c := range chunks {
+		if err := s.AddChunk(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.SetBookMeta(chunks[0].BookID, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	meta := IndexMeta{Embedder: "hash", Dimension: 8}
+	s := openTestStore(t, dir, meta)
+	alice, bob := testChunks("alice", 5, 8), testChunks("bob", 3, 8)
+	addBook(t, s, alice)
+	addBook(t, s, bob)
+	if _, err := s.DeleteBook("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir, meta)
+	defer s.Close()
+	got := s.Chunks()
+	if len(got) != len(alice) {
+		t.Fatalf("reloaded %d chunks, want %d", len(got), len(alice))
+	}
+	for i, c := range got {
+		want := alice[i]
+		if c.ID != want.ID || c.Chapter != want.Chapter || c.StartOffset != want.StartOffset ||
+			c.Metadata["author"] != "Carroll" || !slices.Equal(c.Embedding, want.Embedding) {
+			t.Errorf("chunk %d = %+v, want %+v", i, c, want)
+		}
+	}
+	if books, _ := s.ListBooks(); len(books) != 1 || books[0].BookID != "alice" {
+		t.Errorf("books after reload = %+v, want only alice", books)
+	}
+}
+
+func TestDiskStoreTruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	meta := IndexMeta{Embedder: "hash", Dimension: 8}
+	s := openTestStore(t, dir, meta)
+	alice := testChunks("alice", 3, 8)
+	addBook(t, s, alice)
+	if err := s.AddChunk(testChunks("bob", 1, 8)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut the last record short, as a crash in the middle of an append would.
+	path := filepath.Join(dir, indexFileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir, meta)
+	if n := s.Count(); n != len(alice) {
+		t.Fatalf("loaded %d chunks after a torn record, want %d", n, len(alice))
+	}
+	// The torn bytes are gone, so new records follow the last good one.
+	addBook(t, s, testChunks("bob", 1, 8))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s = openTestStore(t, dir, meta)
+	defer s.Close()
+	if n := s.Count(); n != len(alice)+1 {
+		t.Errorf("loaded %d chunks after re-adding, want %d", n, len(alice)+1)
+	}
+}
+
+func TestDiskStoreDropsUncommittedBook(t *testing.T) {
+	dir := t.TempDir()
+	meta := IndexMeta{Embedder: "hash", Dimension: 8}
+	s := openTestStore(t, dir, meta)
+	addBook(t, s, testChunks("alice", 2, 8))
+	// A crash partway through ingesting bob leaves chunks without a commit.
+	for _, c := range testChunks("bob", 3, 8)[:2] {
+		if err := s.AddChunk(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir, meta)
+	if got := s.DroppedBooks(); !slices.Equal(got, []string{"bob"}) {
+		t.Errorf("DroppedBooks() = %q, want [bob]", got)
+	}
+	if books, _ := s.ListBooks(); len(books) != 1 || books[0].BookID != "alice" {
+		t.Fatalf("books after reload = %+v, want only alice", books)
+	}
+	// bob can be ingested again from scratch.
+	addBook(t, s, testChunks("bob", 3, 8))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir, meta)
+	defer s.Close()
+	if len(s.DroppedBooks()) != 0 || s.Count() != 5 {
+		t.Errorf("reopened with %d chunks, dropped %q; want 5 chunks and nothing dropped", s.Count(), s.DroppedBooks())
+	}
+}
+
+func TestDiskStoreRejectsOversizedRecord(t *testing.T) {
+	dir := t.TempDir()
+	meta := IndexMeta{Embedder: "hash", Dimension: 8}
+	s := openTestStore(t, dir, meta)
+	addBook(t, s, testChunks("alice", 2, 8))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A garbage record header claiming a 4 GiB payload must not be
+	// allocated; it is treated as a torn record.
+	path := filepath.Join(dir, indexFileName)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{recordChunk, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s = openTestStore(t, dir, meta)
+	defer s.Close()
+	if n := s.Count(); n != 2 {
+		t.Errorf("loaded %d chunks, want 2", n)
+	}
+}
+
+func TestDiskStoreDeleteUnknownBookWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir, IndexMeta{Embedder: "hash", Dimension: 8})
+	defer s.Close()
+	addBook(t, s, testChunks("alice", 2, 8))
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, indexFileName)
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.DeleteBook("bob"); n != 0 || err != nil {
+		t.Fatalf("DeleteBook(bob) = %d, %v", n, err)
+	}
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(path); after.Size() != before.Size() {
+		t.Errorf("deleting an unknown book grew the index from %d to %d bytes", before.Size(), after.Size())
+	}
+}
+
+func TestDiskStoreRejectsMismatchedHeader(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir, IndexMeta{Embedder: "hash", Dimension: 8})
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, meta := range []IndexMeta{
+		{Embedder: "tfidf", Dimension: 8},
+		{Embedder: "hash", Dimension: 16},
+	} {
+		_, err := OpenDiskStore(dir, meta, nil)
+		if !errors.Is(err, ErrIncompatibleIndex) {
+			t.Errorf("OpenDiskStore(%+v) = %v, want ErrIncompatibleIndex", meta, err)
+		}
+	}
+}
+
+func TestDiskStoreBookMeta(t *testing.T) {
+	dir := t.TempDir()
+	meta := IndexMeta{Embedder: "hash", Dimension: 8}
+	s := openTestStore(t, dir, meta)
+	for _, c := range append(testChunks("alice", 2, 8), testChunks("bob", 2, 8)...) {
+		if err := s.AddChunk(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range []struct{ book, meta string }{
+		{"alice", `{"chunk_size":100}`},
+		{"bob", `{"chunk_size":200}`},
+		{"alice", `{"chunk_size":300}`},
+	} {
+		if err := s.SetBookMeta(m.book, []byte(m.meta)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.DeleteBook("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir, meta)
+	defer s.Close()
+	if got, ok := s.BookMeta("alice"); !ok || string(got) != `{"chunk_size":300}` {
+		t.Errorf("alice metadata = %q, %v; want the last one set", got, ok)
+	}
+	if got, ok := s.BookMeta("bob"); ok {
+		t.Errorf("deleted book still has metadata %q", got)
+	}
+}
+
+func TestDiskStoreUpgradesVersion1(t *testing.T) {
+	dir := t.TempDir()
+	meta := IndexMeta{Embedder: "hash", Dimension: 8}
+	s := openTestStore(t, dir, meta)
+	if err := s.AddChunk(testChunks("alice", 1, 8)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, indexFileName)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{1, 0}, 4); err != nil { // version 1
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Version 1 had no commit records, so its books are committed rather
+	// than dropped.
+	for run := 0; run < 2; run++ {
+		s = openTestStore(t, dir, meta)
+		if n := s.Count(); n != 1 || len(s.DroppedBooks()) != 0 {
+			t.Errorf("run %d: loaded %d chunks from a version 1 index and dropped %q, want 1 and none", run, n, s.DroppedBooks())
+		}
+		if _, ok := s.BookMeta("alice"); ok {
+			t.Errorf("run %d: upgraded book has metadata", run)
+		}
+		s.Close()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := int(data[4]) | int(data[5])<<8; v != indexVersion {
+		t.Errorf("header version after open = %d, want %d", v, indexVersion)
+	}
+}
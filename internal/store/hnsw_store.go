@@ -0,0 +1,425 @@
+package store
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"ragbook/internal/types"
+)
+
+// HNSWConfig tunes an HNSWStore.
+type HNSWConfig struct {
+	// M is the number of links per node on the upper layers; layer 0 keeps
+	// up to 2*M.
+	M int
+	// EfConstruction is the candidate list size used while inserting.
+	EfConstruction int
+	// EfSearch is the candidate list size used while searching. It is raised
+	// to topK when smaller.
+	EfSearch int
+	// Seed drives level assignment, making graphs reproducible.
+	Seed int64
+	// Score ranks neighbors; nil means cosine similarity.
+	Score Scorer
+}
+
+// DefaultHNSWConfig returns settings that work well for a few hundred
+// thousand chunks.
+func DefaultHNSWConfig() HNSWConfig {
+	return HNSWConfig{M: 16, EfConstruction: 200, EfSearch: 64, Seed: 1}
+}
+
+// HNSWStore is a VectorStore backed by a Hierarchical Navigable Small World
+// graph (Malkov & Yashunin, 2016). Searches are approximate: they visit a
+// small part of the graph instead of scoring every chunk. Deleted chunks stay
+// in the graph as routing nodes but are never returned; once they outnumber
+// the live chunks the graph is rebuilt without them.
+type HNSWStore struct {
+	mu       sync.RWMutex
+	cfg      HNSWConfig
+	score    Scorer
+	rng      *rand.Rand
+	levelMul float64
+
+	nodes    []hnswNode
+	byKey    map[chunkKey]int // live node id
+	entry    int
+	maxLevel int
+	live     int
+}
+
+type hnswNode struct {
+	chunk   types.DocumentChunk
+	links   [][]int // links[layer] holds neighbor node ids
+	deleted bool
+}
+
+// NewHNSWStore creates an empty index. Zero config fields take the values
+// from DefaultHNSWConfig.
+func NewHNSWStore(cfg HNSWConfig) *HNSWStore {
+	def := DefaultHNSWConfig()
+	if cfg.M <= 1 {
+		cfg.M = def.M
+	}
+	if cfg.EfConstruction <= 0 {
+		cfg.EfConstruction = def.EfConstruction
+	}
+	if cfg.EfSearch <= 0 {
+		cfg.EfSearch = def.EfSearch
+	}
+	if cfg.Score == nil {
+		cfg.Score = CosineSimilarity
+	}
+	return &HNSWStore{
+		cfg:      cfg,
+		score:    cfg.Score,
+		rng:      rand.New(rand.NewSource(cfg.Seed)),
+		levelMul: 1 / math.Log(float64(cfg.M)),
+		byKey:    make(map[chunkKey]int),
+		entry:    -1,
+	}
+}
+
+// SetEfSearch changes the search-time candidate list size.
+func (s *HNSWStore) SetEfSearch(ef int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ef > 0 {
+		s.cfg.EfSearch = ef
+	}
+}
+
+func (s *HNSWStore) AddChunk(chunk types.DocumentChunk) error {
+	if chunk.Embedding == nil {
+		return errors.New("chunk has no embedding")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insert(chunk)
+	return nil
+}
+
+// insert adds chunk to the graph. The caller holds the write lock.
+func (s *HNSWStore) insert(chunk types.DocumentChunk) {
+	level := int(-math.Log(1-s.rng.Float64()) * s.levelMul)
+	id := len(s.nodes)
+	s.nodes = append(s.nodes, hnswNode{chunk: chunk, links: make([][]int, level+1)})
+	s.byKey[keyOf(&chunk)] = id
+	s.live++
+
+	if s.entry < 0 {
+		s.entry, s.maxLevel = id, level
+		return
+	}
+
+	q := chunk.Embedding
+	ep := s.entry
+	for l := s.maxLevel; l > level; l-- {
+		ep = s.greedy(q, ep, l)
+	}
+	eps := []int{ep}
+	for l := min(level, s.maxLevel); l >= 0; l-- {
+		found := s.searchLayer(q, eps, s.cfg.EfConstruction, l, nil)
+		neighbors := s.selectNeighbors(q, found, s.cfg.M)
+		s.nodes[id].links[l] = neighbors
+		for _, n := range neighbors {
+			s.link(n, id, l)
+		}
+		eps = make([]int, len(found))
+		for i, c := range found {
+			eps[i] = c.id
+		}
+	}
+	if level > s.maxLevel {
+		s.entry, s.maxLevel = id, level
+	}
+}
+
+// filterScanDivisor bounds the graph walk for filtered searches: a filter
+// that keeps at most one live chunk in filterScanDivisor (or no more than ef
+// chunks) is answered by scoring the matching chunks directly, since the walk
+// would otherwise visit most of the graph to fill its result list.
+const filterScanDivisor = 10
+
+// Search walks the graph from the entry point. A filter is applied during
+// the walk, so filtered-out chunks still guide the search but never take up
+// result slots. Selective filters skip the graph; see filterScanDivisor.
+func (s *HNSWStore) Search(queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error) {
+	topK := opts.TopK
+	if topK <= 0 {
+		topK = 5
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.live == 0 {
+		return nil, nil
+	}
+	ef := max(s.cfg.EfSearch, topK)
+	if opts.Filter != nil {
+		if ids, ok := s.fewMatches(opts.Filter, max(ef, s.live/filterScanDivisor)); ok {
+			results := make([]types.SourceChunk, len(ids))
+			for i, id := range ids {
+				c := &s.nodes[id].chunk
+				results[i] = c.Source(s.score(queryEmbedding, c.Embedding))
+			}
+			return selectTopK(results, topK), nil
+		}
+	}
+	ep := s.entry
+	for l := s.maxLevel; l > 0; l-- {
+		ep = s.greedy(queryEmbedding, ep, l)
+	}
+	found := s.searchLayer(queryEmbedding, []int{ep}, ef, 0, func(id int) bool {
+		n := &s.nodes[id]
+		return !n.deleted && opts.Filter.Match(&n.chunk)
+	})
+	if len(found) > topK {
+		found = found[:topK]
+	}
+	results := make([]types.SourceChunk, len(found))
+	for i, c := range found {
+		results[i] = s.nodes[c.id].chunk.Source(c.score)
+	}
+	return results, nil
+}
+
+// fewMatches returns the live nodes that pass f, or false if there are more
+// than limit of them.
+func (s *HNSWStore) fewMatches(f *types.SearchFilter, limit int) ([]int, bool) {
+	var ids []int
+	for i := range s.nodes {
+		if n := &s.nodes[i]; !n.deleted && f.Match(&n.chunk) {
+			if len(ids) == limit {
+				return nil, false
+			}
+			ids = append(ids, i)
+		}
+	}
+	return ids, true
+}
+
+func (s *HNSWStore) GetChunk(bookID string, index int) (types.DocumentChunk, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.byKey[chunkKey{bookID, index}]
+	if !ok {
+		return types.DocumentChunk{}, false
+	}
+	return s.nodes[id].chunk, true
+}
+
+// Chunks returns all live chunks in insertion order.
+func (s *HNSWStore) Chunks() []types.DocumentChunk {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]types.DocumentChunk, 0, s.live)
+	for _, n := range s.nodes {
+		if !n.deleted {
+			out = append(out, n.chunk)
+		}
+	}
+	return out
+}
+
+func (s *HNSWStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.live
+}
+
+func (s *HNSWStore) DeleteBook(bookID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for i := range s.nodes {
+		if n := &s.nodes[i]; !n.deleted && n.chunk.BookID == bookID {
+			n.deleted = true
+			delete(s.byKey, keyOf(&n.chunk))
+			removed++
+		}
+	}
+	s.live -= removed
+	if len(s.nodes)-s.live > s.live {
+		s.rebuild()
+	}
+	return removed, nil
+}
+
+// rebuild reinserts the live chunks into an empty graph, dropping the
+// tombstones of deleted ones. The caller holds the write lock.
+func (s *HNSWStore) rebuild() {
+	old := s.nodes
+	s.nodes = make([]hnswNode, 0, s.live)
+	s.byKey = make(map[chunkKey]int, s.live)
+	s.entry, s.maxLevel, s.live = -1, 0, 0
+	for _, n := range old {
+		if !n.deleted {
+			s.insert(n.chunk)
+		}
+	}
+}
+
+func (s *HNSWStore) ListBooks() ([]BookStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	live := make([]types.DocumentChunk, 0, s.live)
+	for _, n := range s.nodes {
+		if !n.deleted {
+			live = append(live, n.chunk)
+		}
+	}
+	return countBooks(live, func(c types.DocumentChunk) string { return c.BookID }), nil
+}
+
+// greedy walks layer l from ep towards q and returns the closest node found.
+func (s *HNSWStore) greedy(q []float32, ep, l int) int {
+	best := s.score(q, s.nodes[ep].chunk.Embedding)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range s.nodes[ep].links[l] {
+			if sc := s.score(q, s.nodes[n].chunk.Embedding); sc > best {
+				best, ep, changed = sc, n, true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer returns up to ef nodes on layer l closest to q, best first.
+// When accept is set, rejected nodes are traversed but not returned.
+func (s *HNSWStore) searchLayer(q []float32, eps []int, ef, l int, accept func(int) bool) []hnswCandidate {
+	visited := make(map[int]struct{}, ef*4)
+	candidates := &candidateHeap{}              // best first
+	results := &candidateHeap{worstFirst: true} // worst first, bounded by ef
+
+	for _, ep := range eps {
+		visited[ep] = struct{}{}
+		c := hnswCandidate{id: ep, score: s.score(q, s.nodes[ep].chunk.Embedding)}
+		heap.Push(candidates, c)
+		if accept == nil || accept(ep) {
+			heap.Push(results, c)
+		}
+	}
+	for results.Len() > ef {
+		heap.Pop(results)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && c.score < results.items[0].score {
+			break
+		}
+		for _, n := range s.nodes[c.id].links[l] {
+			if _, seen := visited[n]; seen {
+				continue
+			}
+			visited[n] = struct{}{}
+			sc := s.score(q, s.nodes[n].chunk.Embedding)
+			if results.Len() < ef || sc > results.items[0].score {
+				heap.Push(candidates, hnswCandidate{id: n, score: sc})
+				if accept == nil || accept(n) {
+					heap.Push(results, hnswCandidate{id: n, score: sc})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]hnswCandidate, results.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(results).(hnswCandidate)
+	}
+	return out
+}
+
+// selectNeighbors picks up to m of the candidates (sorted best first) using
+// the diversity heuristic from the HNSW paper: a candidate is kept only if it
+// is closer to the base vector than to every neighbor already kept. Slots left
+// over are filled with the best discarded candidates.
+func (s *HNSWStore) selectNeighbors(base []float32, candidates []hnswCandidate, m int) []int {
+	selected := make([]int, 0, m)
+	var skipped []int
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		emb := s.nodes[c.id].chunk.Embedding
+		keep := true
+		for _, sel := range selected {
+			if s.score(emb, s.nodes[sel].chunk.Embedding) > c.score {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+	for _, id := range skipped {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// link adds a link from node to target on layer l, pruning node's links
+// back to the layer's limit if needed.
+func (s *HNSWStore) link(node, target, l int) {
+	links := append(s.nodes[node].links[l], target)
+	limit := s.cfg.M
+	if l == 0 {
+		limit = 2 * s.cfg.M
+	}
+	if len(links) > limit {
+		base := s.nodes[node].chunk.Embedding
+		cands := make([]hnswCandidate, len(links))
+		for i, n := range links {
+			cands[i] = hnswCandidate{id: n, score: s.score(base, s.nodes[n].chunk.Embedding)}
+		}
+		sortCandidates(cands)
+		links = s.selectNeighbors(base, cands, limit)
+	}
+	s.nodes[node].links[l] = links
+}
+
+type hnswCandidate struct {
+	id    int
+	score float32
+}
+
+// candidateHeap is a heap of candidates ordered best first, or worst first
+// when worstFirst is set.
+type candidateHeap struct {
+	items      []hnswCandidate
+	worstFirst bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.worstFirst {
+		return h.items[i].score < h.items[j].score
+	}
+	return h.items[i].score > h.items[j].score
+}
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *candidateHeap) Push(x any)    { h.items = append(h.items, x.(hnswCandidate)) }
+func (h *candidateHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+func sortCandidates(c []hnswCandidate) {
+	sort.Slice(c, func(i, j int) bool { return c[i].score > c[j].score })
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+func TestHNSWRecall(t *testing.T) {
+	const n, dim, topK, queries = 1000, 32, 10, 50
+	rng := rand.New(rand.NewSource(3))
+	hnsw, exact := NewHNSWStore(DefaultHNSWConfig()), NewMemoryStore()
+	for i := 0; i < n; i++ {
+		c := types.DocumentChunk{
+			ID:        fmt.Sprintf("b-%d", i),
+			BookID:    "b",
+			Index:     i,
+			Embedding: randomVector(rng, dim),
+		}
+		if err := hnsw.AddChunk(c); err != nil {
+			t.Fatal(err)
+		}
+		if err := exact.AddChunk(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits := 0
+	for q := 0; q < queries; q++ {
+		query := randomVector(rng, dim)
+		want, err := exact.Search(query, SearchOptions{TopK: topK})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := hnsw.Search(query, SearchOptions{TopK: topK})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make(map[string]bool, len(got))
+		for _, r := range got {
+			found[r.ID] = true
+		}
+		for _, r := range want {
+			if found[r.ID] {
+				hits++
+			}
+		}
+	}
+	if recall := float64(hits) / (queries * topK); recall < 0.9 {
+		t.Errorf("recall@%d = %.3f, want at least 0.9", topK, recall)
+	} else {
+		t.Logf("recall@%d = %.3f", topK, recall)
+	}
+}
+
+// vectorChunks returns n chunks of book with random dim-dimensional
+// embeddings.
+func vectorChunks(rng *rand.Rand, book string, n, dim int) []types.DocumentChunk {
+	chunks := make([]types.DocumentChunk, n)
+	for i := range chunks {
+		chunks[i] = types.DocumentChunk{ID: fmt.Sprintf("%s-%d", book, i), BookID: book, Index: i, Embedding: randomVector(rng, dim)}
+	}
+	return chunks
+}
+
+func sourceIDs(sources []types.SourceChunk) []string {
+	ids := make([]string, len(sources))
+	for i, s := range sources {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+func TestHNSWSelectiveFilterScansMatches(t *testing.T) {
+	var scored atomic.Int32
+	cfg := DefaultHNSWConfig()
+	cfg.Score = func(a, b []float32) float32 {
+		scored.Add(1)
+		return CosineSimilarity(a, b)
+	}
+	rng := rand.New(rand.NewSource(5))
+	hnsw, exact := NewHNSWStore(cfg), NewMemoryStore()
+	for _, c := range append(vectorChunks(rng, "big", 990, 16), vectorChunks(rng, "small", 10, 16)...) {
+		hnsw.AddChunk(c)
+		exact.AddChunk(c)
+	}
+
+	query := randomVector(rng, 16)
+	opts := SearchOptions{TopK: 3, Filter: &types.SearchFilter{BookIDs: []string{"small"}}}
+	scored.Store(0)
+	got, err := hnsw.Search(query, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := scored.Load(); n != 10 {
+		t.Errorf("scored %d chunks, want only the 10 that match", n)
+	}
+	want, _ := exact.Search(query, opts)
+	if !slices.Equal(sourceIDs(got), sourceIDs(want)) {
+		t.Errorf("got %v, want %v", sourceIDs(got), sourceIDs(want))
+	}
+
+	// A filter that keeps most chunks still walks the graph.
+	opts.Filter.BookIDs = []string{"big"}
+	scored.Store(0)
+	got, _ = hnsw.Search(query, opts)
+	if n := scored.Load(); n >= 990 {
+		t.Errorf("scored %d chunks for an unselective filter", n)
+	}
+	if len(got) != 3 || got[0].BookID != "big" || got[2].BookID != "big" {
+		t.Errorf("got %+v, want 3 chunks of big", got)
+	}
+}
+
+func TestHNSWRebuildsAfterDeletes(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	s := NewHNSWStore(DefaultHNSWConfig())
+	kept := vectorChunks(rng, "kept", 10, 8)
+	for _, c := range append(kept, vectorChunks(rng, "gone", 30, 8)...) {
+		s.AddChunk(c)
+	}
+
+	// Fewer tombstones than live chunks are kept as routing nodes.
+	if n, _ := s.DeleteBook("kept"); n != 10 || len(s.nodes) != 40 {
+		t.Fatalf("deleted %d, graph has %d nodes; want 10 and 40", n, len(s.nodes))
+	}
+	for _, c := range kept {
+		s.AddChunk(c)
+	}
+
+	// Deleting gone leaves 40 tombstones against 10 live chunks.
+	if n, _ := s.DeleteBook("gone"); n != 30 {
+		t.Fatalf("deleted %d chunks, want 30", n)
+	}
+	if len(s.nodes) != 10 || s.Count() != 10 {
+		t.Fatalf("graph has %d nodes and %d live chunks after rebuild, want 10", len(s.nodes), s.Count())
+	}
+	for _, c := range kept {
+		got, err := s.Search(c.Embedding, SearchOptions{TopK: 1})
+		if err != nil || len(got) != 1 || got[0].ID != c.ID {
+			t.Errorf("nearest to %s = %+v, %v", c.ID, got, err)
+		}
+		if stored, ok := s.GetChunk("kept", c.Index); !ok || stored.ID != c.ID {
+			t.Errorf("GetChunk(kept, %d) = %s, %v", c.Index, stored.ID, ok)
+		}
+	}
+
+	s.DeleteBook("kept")
+	if len(s.nodes) != 0 || s.entry != -1 {
+		t.Errorf("emptied graph has %d nodes and entry %d", len(s.nodes), s.entry)
+	}
+	if got, _ := s.Search(kept[0].Embedding, SearchOptions{TopK: 1}); len(got) != 0 {
+		t.Errorf("empty store returned %+v", got)
+	}
+	if err := s.AddChunk(kept[0]); err != nil || s.Count() != 1 {
+		t.Errorf("AddChunk after rebuild: %v, count %d", err, s.Count())
+	}
+}
+
+func TestDiskStoreWithHNSWIndex(t *testing.T) {
+	dir := t.TempDir()
+	meta := IndexMeta{Embedder: "hash", Dimension: 8}
+	chunks := testChunks("alice", 5, 8)
+	for run := 0; run < 2; run++ {
+		s, err := OpenDiskStoreWithIndex(dir, meta, NewHNSWStore(DefaultHNSWConfig()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run == 0 {
+			addBook(t, s, chunks)
+		}
+		got, err := s.Search(chunks[3].Embedding, SearchOptions{TopK: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].ID != chunks[3].ID {
+			t.Errorf("run %d: nearest chunk = %+v, want %s", run, got, chunks[3].ID)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	index := NewHNSWStore(DefaultHNSWConfig())
+	index.AddChunk(chunks[0])
+	if _, err := OpenDiskStoreWithIndex(t.TempDir(), meta, index); err == nil {
+		t.Error("OpenDiskStoreWithIndex accepted a non-empty index")
+	}
+}
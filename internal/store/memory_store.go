@@ -1,9 +1,11 @@
 package store
 
 import (
+	"cmp"
+	"context"
 	"errors"
-	"math"
-	"math/rand"
+	"slices"
+	"sort"
 	"sync"
 
 	"ragbook/internal/types"
@@ -12,18 +14,94 @@ import (
 // VectorStore interface
 type VectorStore interface {
 	AddChunk(chunk types.DocumentChunk) error
-	Search(queryEmbedding []float32, topK int) ([]types.SourceChunk, error)
+	Search(queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error)
 	Count() int
+	// DeleteBook removes every chunk of a book and returns how many were removed.
+	DeleteBook(bookID string) (int, error)
+	// ListBooks returns the stored books ordered by ID.
+	ListBooks() ([]BookStats, error)
+	// GetChunk returns the chunk of a book with the given index.
+	GetChunk(bookID string, index int) (types.DocumentChunk, bool)
 }
 
+// SearchOptions controls a vector search.
+type SearchOptions struct {
+	// TopK is the number of results; 0 means 5.
+	TopK int
+	// Filter restricts the candidates before top-k selection.
+	Filter *types.SearchFilter
+}
+
+// BookStats describes one book in a store.
+type BookStats struct {
+	BookID string `json:"book_id"`
+	Chunks int    `json:"chunks"`
+}
+
+// ChunkLister is implemented by stores that can enumerate their chunks, e.g.
+// to rebuild auxiliary indexes after loading from disk.
+type ChunkLister interface {
+	Chunks() []types.DocumentChunk
+}
+
+// BookMetaStore is implemented by persistent stores that keep opaque
+// per-book metadata, such as how a book was ingested, with its chunks.
+// Setting the metadata last commits the book's chunks: a store may drop a
+// book without metadata after a crash. Deleting a book deletes its metadata.
+type BookMetaStore interface {
+	SetBookMeta(bookID string, meta []byte) error
+	BookMeta(bookID string) ([]byte, bool)
+}
+
+// Syncer is implemented by persistent stores that buffer writes.
+type Syncer interface {
+	Sync() error
+}
+
+// chunkKey locates a chunk within its book.
+type chunkKey struct {
+	bookID string
+	index  int
+}
+
+func keyOf(c *types.DocumentChunk) chunkKey { return chunkKey{c.BookID, c.Index} }
+
 // MemoryStore: simple in-memory store
 type MemoryStore struct {
 	mu     sync.RWMutex
 	chunks []types.DocumentChunk
+	byKey  map[chunkKey]int // position in chunks
+	score  Scorer
 }
 
+// NewMemoryStore creates a store that ranks chunks by cosine similarity.
 func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{chunks: make([]types.DocumentChunk, 0)}
+	return NewMemoryStoreWithScorer(CosineSimilarity)
+}
+
+// NewMemoryStoreWithMetric creates a store that ranks chunks by the given metric.
+func NewMemoryStoreWithMetric(m Metric) (*MemoryStore, error) {
+	score, err := ScorerFor(m)
+	if err != nil {
+		return nil, err
+	}
+	return NewMemoryStoreWithScorer(score), nil
+}
+
+// NewMemoryStoreWithScorer creates a store that ranks chunks with a custom scorer.
+func NewMemoryStoreWithScorer(score Scorer) *MemoryStore {
+	if score == nil {
+		score = CosineSimilarity
+	}
+	return &MemoryStore{chunks: make([]types.DocumentChunk, 0), byKey: make(map[chunkKey]int), score: score}
+}
+
+// AddChunkContext adds chunk unless ctx is already done.
+func (s *MemoryStore) AddChunkContext(ctx context.Context, chunk types.DocumentChunk) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.AddChunk(chunk)
 }
 
 func (s *MemoryStore) AddChunk(chunk types.DocumentChunk) error {
@@ -32,11 +110,32 @@ func (s *MemoryStore) AddChunk(chunk types.DocumentChunk) error {
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.byKey[keyOf(&chunk)] = len(s.chunks)
 	s.chunks = append(s.chunks, chunk)
 	return nil
 }
 
-func (s *MemoryStore) Search(queryEmbedding []float32, topK int) ([]types.SourceChunk, error) {
+func (s *MemoryStore) GetChunk(bookID string, index int) (types.DocumentChunk, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.byKey[chunkKey{bookID, index}]
+	if !ok {
+		return types.DocumentChunk{}, false
+	}
+	return s.chunks[i], true
+}
+
+func (s *MemoryStore) Search(queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error) {
+	return s.SearchContext(context.Background(), queryEmbedding, opts)
+}
+
+// ctxCheckInterval is how many chunks a scan scores between checks of the
+// context.
+const ctxCheckInterval = 4096
+
+// SearchContext is Search, abandoning the scan once ctx is done.
+func (s *MemoryStore) SearchContext(ctx context.Context, queryEmbedding []float32, opts SearchOptions) ([]types.SourceChunk, error) {
+	topK := opts.TopK
 	if topK <= 0 {
 		topK = 5
 	}
@@ -48,92 +147,82 @@ func (s *MemoryStore) Search(queryEmbedding []float32, topK int) ([]types.Source
 	}
 
 	results := make([]types.SourceChunk, 0, len(s.chunks))
-	for _, c := range s.chunks {
-		score := cosineSimilarity(queryEmbedding, c.Embedding)
-		results = append(results, types.SourceChunk{
-			ID:     c.ID,
-			BookID: c.BookID,
-			Index:  c.Index,
-			Score:  score,
-			Text:   c.Text,
-		})
+	for i := range s.chunks {
+		if i%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		c := &s.chunks[i]
+		if !opts.Filter.Match(c) {
+			continue
+		}
+		results = append(results, c.Source(s.score(queryEmbedding, c.Embedding)))
 	}
 
 	top := selectTopK(results, topK)
 	return top, nil
 }
 
+// Chunks returns a copy of all stored chunks in insertion order.
+func (s *MemoryStore) Chunks() []types.DocumentChunk {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]types.DocumentChunk(nil), s.chunks...)
+}
+
 func (s *MemoryStore) Count() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return len(s.chunks)
 }
 
-func cosineSimilarity(a, b []float32) float32 {
-	if len(a) != len(b) || len(a) == 0 {
-		return 0
-	}
-	var dot, na, nb float32
-	for i := range a {
-		dot += a[i] * b[i]
-		na += a[i] * a[i]
-		nb += b[i] * b[i]
-	}
-	if na == 0 || nb == 0 {
-		return 0
-	}
-	score := dot / (float32(math.Sqrt(float64(na))) * float32(math.Sqrt(float64(nb))))
-
-	// --- Simulate realistic score variation for HashEmbedder (for testing only) ---
-	if score < 0 {
-		score = 0
+func (s *MemoryStore) DeleteBook(bookID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.chunks[:0]
+	for _, c := range s.chunks {
+		if c.BookID != bookID {
+			kept = append(kept, c)
+		}
 	}
-	if score > 1 {
-		score = 1
+	removed := len(s.chunks) - len(kept)
+	clear(s.chunks[len(kept):])
+	s.chunks = kept
+	if removed > 0 {
+		clear(s.byKey)
+		for i := range s.chunks {
+			s.byKey[keyOf(&s.chunks[i])] = i
+		}
 	}
-	// Randomly scale score between 0.5–1.0 range
-	score = score * (0.8 + 0.2*rand.Float32())
+	return removed, nil
+}
 
-	return score
+func (s *MemoryStore) ListBooks() ([]BookStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return countBooks(s.chunks, func(c types.DocumentChunk) string { return c.BookID }), nil
 }
 
-func selectTopK(items []types.SourceChunk, k int) []types.SourceChunk {
-	if k >= len(items) {
-		quickSortByScore(items, 0, len(items)-1)
-		return items
+// countBooks tallies items per book, ordered by book ID.
+func countBooks[T any](items []T, bookOf func(T) string) []BookStats {
+	counts := make(map[string]int)
+	for _, it := range items {
+		counts[bookOf(it)]++
 	}
-	result := make([]types.SourceChunk, 0, k)
-	for i := 0; i < k; i++ {
-		bestIdx := i
-		for j := i + 1; j < len(items); j++ {
-			if items[j].Score > items[bestIdx].Score {
-				bestIdx = j
-			}
-		}
-		items[i], items[bestIdx] = items[bestIdx], items[i]
-		result = append(result, items[i])
+	stats := make([]BookStats, 0, len(counts))
+	for id, n := range counts {
+		stats = append(stats, BookStats{BookID: id, Chunks: n})
 	}
-	return result
+	sort.Slice(stats, func(i, j int) bool { return stats[i].BookID < stats[j].BookID })
+	return stats
 }
 
-func quickSortByScore(a []types.SourceChunk, lo, hi int) {
-	if lo >= hi {
-		return
-	}
-	p := partition(a, lo, hi)
-	quickSortByScore(a, lo, p-1)
-	quickSortByScore(a, p+1, hi)
-}
-
-func partition(a []types.SourceChunk, lo, hi int) int {
-	pivot := a[hi].Score
-	i := lo
-	for j := lo; j < hi; j++ {
-		if a[j].Score > pivot {
-			a[i], a[j] = a[j], a[i]
-			i++
-		}
-	}
-	a[i], a[hi] = a[hi], a[i]
-	return i
+// selectTopK returns the k best-scoring items. Equal scores keep their
+// order in items, so the ranking of ties does not depend on k.
+func selectTopK(items []types.SourceChunk, k int) []types.SourceChunk {
+	slices.SortStableFunc(items, func(a, b types.SourceChunk) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return items[:min(k, len(items))]
 }
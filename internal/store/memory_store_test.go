@@ -0,0 +1,75 @@
+package store
+
+import (
+	"slices"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+// filterChunks returns ten alice chunks close to the query [1, 0] and, far
+// from it, bob's chapters 1–3, only chapter 2 of which is by Doyle.
+func filterChunks() []types.DocumentChunk {
+	var chunks []types.DocumentChunk
+	for i := 0; i < 10; i++ {
+		chunks = append(chunks, types.DocumentChunk{
+			ID: "alice-" + string(rune('a'+i)), BookID: "alice", Index: i, Chapter: 1,
+			Embedding: []float32{1, float32(i) / 100},
+		})
+	}
+	for i := 0; i < 3; i++ {
+		author := "Carroll"
+		if i == 1 {
+			author = "Doyle"
+		}
+		chunks = append(chunks, types.DocumentChunk{
+			ID: "bob-" + string(rune('a'+i)), BookID: "bob", Index: i, Chapter: i + 1,
+			Metadata:  map[string]string{"author": author},
+			Embedding: []float32{float32(i) / 100, 1},
+		})
+	}
+	return chunks
+}
+
+func TestSearchFilterPushdown(t *testing.T) {
+	disk := openTestStore(t, t.TempDir(), IndexMeta{Embedder: "hash", Dimension: 2})
+	defer disk.Close()
+	mem := NewMemoryStore()
+	chunks := filterChunks()
+	for _, c := range chunks {
+		if err := mem.AddChunk(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addBook(t, disk, chunks[:10])
+	addBook(t, disk, chunks[10:])
+
+	// Every alice chunk beats every bob chunk, so filtering after taking
+	// the top 2 would return nothing.
+	tests := []struct {
+		name   string
+		filter *types.SearchFilter
+		want   []string
+	}{
+		{"book", &types.SearchFilter{BookIDs: []string{"bob"}}, []string{"bob-c", "bob-b"}},
+		{"chapter range", &types.SearchFilter{ChapterFrom: 2, ChapterTo: 2}, []string{"bob-b"}},
+		{"open chapter range", &types.SearchFilter{ChapterFrom: 2}, []string{"bob-c", "bob-b"}},
+		{"metadata", &types.SearchFilter{Metadata: map[string]string{"author": "Doyle"}}, []string{"bob-b"}},
+		{"no match", &types.SearchFilter{BookIDs: []string{"carol"}}, nil},
+	}
+	for _, s := range []VectorStore{mem, disk} {
+		for _, tt := range tests {
+			got, err := s.Search([]float32{1, 0}, SearchOptions{TopK: 2, Filter: tt.filter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, r := range got {
+				ids = append(ids, r.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("%T %s: got %v, want %v", s, tt.name, ids, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Metric names a similarity function used to rank chunks against a query.
+type Metric string
+
+const (
+	MetricCosine Metric = "cosine"
+	MetricDot    Metric = "dot"
+	MetricL2     Metric = "l2"
+)
+
+// Scorer compares two embeddings. Higher scores mean more similar.
+type Scorer func(a, b []float32) float32
+
+// ParseMetric resolves a metric name such as "cosine", "dot" or "l2".
+func ParseMetric(name string) (Metric, error) {
+	switch m := Metric(strings.ToLower(strings.TrimSpace(name))); m {
+	case "", MetricCosine:
+		return MetricCosine, nil
+	case MetricDot, MetricL2:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown similarity metric %q", name)
+	}
+}
+
+// ScorerFor returns the deterministic scorer for a metric.
+func ScorerFor(m Metric) (Scorer, error) {
+	switch m {
+	case "", MetricCosine:
+		return CosineSimilarity, nil
+	case MetricDot:
+		return DotProduct, nil
+	case MetricL2:
+		return NegativeL2, nil
+	default:
+		return nil, fmt.Errorf("unknown similarity metric %q", m)
+	}
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b,
+// or 0 if the vectors differ in length or either is all zeros.
+func CosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float32
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (float32(math.Sqrt(float64(na))) * float32(math.Sqrt(float64(nb))))
+}
+
+// DotProduct returns the inner product of a and b.
+func DotProduct(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float32
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot
+}
+
+// NegativeL2 returns the negated Euclidean distance between a and b, so that
+// closer vectors score higher.
+func NegativeL2(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return float32(math.Inf(-1))
+	}
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return -float32(math.Sqrt(float64(sum)))
+}
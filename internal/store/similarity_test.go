@@ -0,0 +1,105 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"ragbook/internal/types"
+)
+
+func TestScorers(t *testing.T) {
+	a, b := []float32{3, 4}, []float32{4, 3}
+	tests := []struct {
+		metric Metric
+		want   float32
+	}{
+		{MetricCosine, 24.0 / 25},
+		{MetricDot, 24},
+		{MetricL2, -float32(math.Sqrt2)},
+	}
+	for _, tt := range tests {
+		score, err := ScorerFor(tt.metric)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := score(a, b); math.Abs(float64(got-tt.want)) > 1e-6 {
+			t.Errorf("%s(%v, %v) = %v, want %v", tt.metric, a, b, got, tt.want)
+		}
+	}
+	if got := CosineSimilarity([]float32{0, 0}, a); got != 0 {
+		t.Errorf("cosine with a zero vector = %v, want 0", got)
+	}
+	if _, err := ParseMetric("manhattan"); err == nil {
+		t.Error("ParseMetric accepted an unknown metric")
+	}
+}
+
+// tiedChunks returns chunks whose embeddings repeat every few chunks, so
+// many of them score exactly the same against any query.
+func tiedChunks(n, dim int) []types.DocumentChunk {
+	rng := rand.New(rand.NewSource(1))
+	distinct := make([][]float32, 4)
+	for i := range distinct {
+		distinct[i] = randomVector(rng, dim)
+	}
+	chunks := make([]types.DocumentChunk, n)
+	for i := range chunks {
+		chunks[i] = types.DocumentChunk{
+			ID:        fmt.Sprintf("b-%d", i),
+			BookID:    "b",
+			Index:     i,
+			Embedding: distinct[i%len(distinct)],
+		}
+	}
+	return chunks
+}
+
+func randomVector(rng *rand.Rand, dim int) []float32 {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = rng.Float32()*2 - 1
+	}
+	return v
+}
+
+func TestSearchRankingIsDeterministic(t *testing.T) {
+	chunks := tiedChunks(40, 8)
+	query := randomVector(rand.New(rand.NewSource(2)), 8)
+	for _, m := range []Metric{MetricCosine, MetricDot, MetricL2} {
+		var first []types.SourceChunk
+		for run := 0; run < 5; run++ {
+			s, err := NewMemoryStoreWithMetric(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range chunks {
+				if err := s.AddChunk(c); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, topK := range []int{3, 10, len(chunks)} {
+				got, err := s.Search(query, SearchOptions{TopK: topK})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if first == nil {
+					first, err = s.Search(query, SearchOptions{TopK: len(chunks)})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				// Every search, in every store and for every top_k, ranks
+				// ties the same way: as a prefix of the first full ranking.
+				for i, r := range got {
+					want := first[i]
+					if r.ID != want.ID || math.Float32bits(r.Score) != math.Float32bits(want.Score) {
+						t.Fatalf("%s run %d top_k %d: rank %d is %s (%v), want %s (%v)",
+							m, run, topK, i, r.ID, r.Score, want.ID, want.Score)
+					}
+				}
+			}
+		}
+	}
+}
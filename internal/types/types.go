@@ -1,27 +1,132 @@
 package types
 
+import "slices"
+
 // DocumentChunk represents a chunk of the book with its embedding.
 type DocumentChunk struct {
-	ID        string    `json:"id"`
-	BookID    string    `json:"book_id"`
-	Index     int       `json:"index"`
-	Text      string    `json:"text"`
-	Embedding []float32 `json:"-"` // not serialized
+	ID           string `json:"id"`
+	BookID       string `json:"book_id"`
+	Index        int    `json:"index"`
+	Text         string `json:"text"`
+	Chapter      int    `json:"chapter,omitempty"`
+	ChapterTitle string `json:"chapter_title,omitempty"`
+	Section      string `json:"section,omitempty"`
+	StartOffset  int    `json:"start_offset"` // rune offset into the book text as given, before normalization
+	EndOffset    int    `json:"end_offset"`
+	// Metadata holds arbitrary key/values attached at ingest, e.g. author.
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Embedding []float32         `json:"-"` // not serialized
+}
+
+// Source converts the chunk into a search result with the given score.
+func (c DocumentChunk) Source(score float32) SourceChunk {
+	return SourceChunk{
+		ID:           c.ID,
+		BookID:       c.BookID,
+		Index:        c.Index,
+		Score:        score,
+		Text:         c.Text,
+		Chapter:      c.Chapter,
+		ChapterTitle: c.ChapterTitle,
+		Section:      c.Section,
+		StartOffset:  c.StartOffset,
+		EndOffset:    c.EndOffset,
+		Metadata:     c.Metadata,
+		Embedding:    c.Embedding,
+	}
 }
 
 // QueryRequest is the JSON payload for /api/v1/query.
 type QueryRequest struct {
 	Query string `json:"query"`
-	TopK  int    `json:"top_k,omitempty"`
+	// TopK is the number of chunks returned, 1–100; nil or 0 means the
+	// default. The other numeric options are pointers so that an explicit
+	// 0 can override a server default; nil means the default.
+	TopK *int `json:"top_k,omitempty"`
+	// RetrievalMode is "vector" (default), "keyword" (BM25), "hybrid"
+	// (reciprocal rank fusion) or "hybrid_weighted" (weighted score fusion).
+	RetrievalMode string `json:"retrieval_mode,omitempty"`
+	// Filter restricts retrieval to matching chunks before top-k selection.
+	Filter *SearchFilter `json:"filter,omitempty"`
+	// MinScore drops chunks whose vector similarity to the query is below
+	// it, before fusion and reranking: in the hybrid modes only vector
+	// candidates are filtered, and keyword mode ignores it. The scale
+	// depends on the similarity metric; negative-L2 scores are below 0, so
+	// 0 is a real threshold and nil means none.
+	MinScore *float32 `json:"min_score,omitempty"`
+	// Diversity is "none" (default), "mmr" (maximal marginal relevance) or
+	// "dedupe" (drop chunks overlapping a better-ranked one).
+	Diversity string `json:"diversity,omitempty"`
+	// MMRLambda weights relevance against diversity for "mmr", from 0
+	// (diversity only) to 1 (relevance only); nil means the default, 0.7.
+	MMRLambda *float32 `json:"mmr_lambda,omitempty"`
+	// Expand adds up to this many neighboring chunks of the same book on
+	// each side of every hit, stitched into one passage.
+	Expand *int `json:"expand,omitempty"`
+	// Rerank is "none" (default), "proximity" (query term proximity and
+	// phrase matches), "bm25" or "cross_encoder" (the server's reranking
+	// model, if configured).
+	Rerank string `json:"rerank,omitempty"`
+	// RerankDepth is how many candidates are retrieved for reranking
+	// before the top_k best are kept, 1–200; nil means the default, 50.
+	RerankDepth *int `json:"rerank_depth,omitempty"`
+}
+
+// SearchFilter restricts retrieval to chunks matching every set field.
+type SearchFilter struct {
+	// BookIDs matches chunks of any of the listed books.
+	BookIDs []string `json:"book_ids,omitempty"`
+	// ChapterFrom and ChapterTo bound the chapter number, inclusive; zero
+	// leaves that end open. Chunks without a chapter never match a range.
+	ChapterFrom int `json:"chapter_from,omitempty"`
+	ChapterTo   int `json:"chapter_to,omitempty"`
+	// Metadata matches chunks whose metadata has all these key/values.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Match reports whether c passes the filter. A nil filter matches everything.
+func (f *SearchFilter) Match(c *DocumentChunk) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.BookIDs) > 0 && !slices.Contains(f.BookIDs, c.BookID) {
+		return false
+	}
+	if f.ChapterFrom > 0 || f.ChapterTo > 0 {
+		if c.Chapter == 0 || c.Chapter < f.ChapterFrom || (f.ChapterTo > 0 && c.Chapter > f.ChapterTo) {
+			return false
+		}
+	}
+	for k, v := range f.Metadata {
+		if got, ok := c.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
 }
 
 // SourceChunk represents a retrieved chunk with similarity score.
 type SourceChunk struct {
-	ID     string  `json:"id"`
-	BookID string  `json:"book_id"`
-	Index  int     `json:"index"`
-	Score  float32 `json:"score"`
-	Text   string  `json:"text"`
+	ID           string            `json:"id"`
+	BookID       string            `json:"book_id"`
+	Index        int               `json:"index"`
+	Score        float32           `json:"score"` // the rerank score if reranked, else the retrieval score
+	Text         string            `json:"text"`
+	Chapter      int               `json:"chapter,omitempty"`
+	ChapterTitle string            `json:"chapter_title,omitempty"`
+	Section      string            `json:"section,omitempty"`
+	StartOffset  int               `json:"start_offset"`
+	EndOffset    int               `json:"end_offset"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	// RetrievalScore is the score the retriever gave the chunk and
+	// RerankScore the reranker's, when the query was reranked.
+	RetrievalScore float32  `json:"retrieval_score"`
+	RerankScore    *float32 `json:"rerank_score,omitempty"`
+	// ChunkIndexes lists the chunks stitched into Text when the hit was
+	// expanded with its neighbors; StartOffset and EndOffset then span
+	// all of them.
+	ChunkIndexes []int     `json:"chunk_indexes,omitempty"`
+	Embedding    []float32 `json:"-"` // for diversification; not serialized
 }
 
 // QueryResponse is returned by /api/v1/query.